@@ -0,0 +1,40 @@
+// Package bytesize parses the sizes given in the command line, shared by the size filters and the
+// bandwidth limit so both accept the same units
+package bytesize
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// units are the accepted suffixes, the longer ones first
+var units = []struct {
+	suffix string
+	value  float64
+}{
+	{"kib", 1 << 10}, {"mib", 1 << 20}, {"gib", 1 << 30},
+	{"kb", 1000}, {"mb", 1000 * 1000}, {"gb", 1000 * 1000 * 1000},
+	{"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000},
+	{"b", 1},
+}
+
+// Parse parses a size such as "500KB", "1.5GiB" or "100M", ignoring the case of the unit.
+// A number without a unit is in bytes.
+func Parse(s string) (float64, error) {
+	number := strings.TrimSpace(s)
+	multiplier := 1.0
+	for _, unit := range units {
+		if strings.HasSuffix(strings.ToLower(number), unit.suffix) {
+			number = number[:len(number)-len(unit.suffix)]
+			multiplier = unit.value
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return value * multiplier, nil
+}
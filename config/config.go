@@ -0,0 +1,82 @@
+// Package config reads the optional configuration file, that holds the settings that are
+// too detailed for the command line, such as the settings of every course
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// DefaultPath is the configuration file read when --config is not given, next to the token file
+const DefaultPath = "agdownloader.json"
+
+// Config is the content of the configuration file
+type Config struct {
+	Courses map[string]CourseSettings `json:"courses,omitempty"` // Settings of every course, keyed by course ID
+	Aliases map[string]string         `json:"aliases,omitempty"` // Names given to the courses, keyed by course ID
+	// ExcludeCourses hides courses from the selection. If it is missing, the default list is used.
+	ExcludeCourses []string `json:"exclude_courses"`
+}
+
+// CourseSettings override the command-line options for a single course.
+// Empty fields keep the value of the options.
+type CourseSettings struct {
+	Enabled *bool    `json:"enabled,omitempty"` // false skips the course, even if it is selected
+	Dir     string   `json:"dir,omitempty"`     // Name of the directory of the course, the {course} variable of the layout
+	Layout  string   `json:"layout,omitempty"`
+	Modules []string `json:"modules,omitempty"` // Types of module to download, e.g. resource or folder. Empty downloads all
+
+	Filters        []string `json:"filters,omitempty"` // Checked before the --filter rules
+	Include        []string `json:"include,omitempty"` // Replace --include
+	Exclude        []string `json:"exclude,omitempty"` // Replace --exclude
+	MinSize        string   `json:"min_size,omitempty"`
+	MaxSize        string   `json:"max_size,omitempty"`
+	ModifiedSince  string   `json:"modified_since,omitempty"`
+	ModifiedBefore string   `json:"modified_before,omitempty"`
+}
+
+// IsEnabled reports whether the course must be downloaded
+func (s CourseSettings) IsEnabled() bool {
+	return s.Enabled == nil || *s.Enabled
+}
+
+// Load reads the configuration file. A missing file is only an error if it was required,
+// i.e. given with --config, otherwise an empty configuration is returned.
+func Load(path string, required bool) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading the configuration file: %v", err)
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("error parsing the configuration file %s: %v", path, err)
+	}
+	ids := make([]string, 0, len(config.Courses)+len(config.Aliases))
+	for id := range config.Courses {
+		ids = append(ids, id)
+	}
+	for id := range config.Aliases {
+		ids = append(ids, id)
+	}
+	for _, id := range ids {
+		if _, err := strconv.Atoi(id); err != nil {
+			return nil, fmt.Errorf("error in the configuration file %s: %q is not a course ID", path, id)
+		}
+	}
+	return &config, nil
+}
+
+// Course returns the settings of a course, empty if it has none
+func (c *Config) Course(id string) CourseSettings {
+	if c == nil {
+		return CourseSettings{}
+	}
+	return c.Courses[id]
+}
@@ -5,9 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"regexp"
 	"strings"
+
+	logging "github.com/Astrak00/AGDownloader/logging"
 )
 
 const URLToken = "https://aulaglobal.uc3m.es/admin/tool/mobile/launch.php?service=moodle_mobile_app&passport=82.93261629596182&urlscheme=moodlemobile"
@@ -16,7 +19,7 @@ func CookieToToken(cookie string) string {
 	// This function will convert the cookie to the token
 	_, err := getToken(cookie)
 	if err == nil {
-		fmt.Println("Error:", err)
+		slog.Error("Unexpected response while obtaining the token")
 		return ""
 	}
 	token, shouldNotReturn := extractTokenFromError(err)
@@ -91,7 +94,7 @@ func extractTokenFromError(err error) (string, bool) {
 	matches := pattern.FindStringSubmatch(err.Error())
 
 	if matches == nil {
-		fmt.Println("Regex not found in the error")
+		slog.Error("Token not found in the launch response")
 		return "", true
 	}
 
@@ -99,19 +102,19 @@ func extractTokenFromError(err error) (string, bool) {
 	token = strings.Replace(token, ")", "", -1)
 	parts := strings.Split(token, "\"")
 	if len(parts) < 1 {
-		fmt.Println("No token found")
+		slog.Error("No token found in the launch response")
 		return "", true
 	}
 
 	decodedToken, err := base64.StdEncoding.DecodeString(parts[0])
 	if err != nil {
-		fmt.Println("Token:", err)
+		slog.Error("Error decoding the token", logging.KeyError, err)
 		return "", true
 	}
 
 	decodedTokenList := strings.Split(string(decodedToken), ":::")
 	if len(decodedTokenList) != 2 {
-		fmt.Println("\":::\" not found in the token")
+		slog.Error("\":::\" not found in the token")
 		return "", true
 	}
 
@@ -0,0 +1,224 @@
+// Package coursename extracts the Spanish or English name of a course from the bilingual names
+// AulaGlobal uses, such as "Tecnología de Computadores 21/22-2C Computer Technology 21/22-S2"
+package coursename
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Languages of the names, the same values used by the -l option
+const (
+	Spanish = 1
+	English = 2
+)
+
+// Input is the information of a course the name is derived from
+type Input struct {
+	ID          string
+	FullName    string // Fullname or, if available, Fullnamedisplay
+	ShortName   string
+	IDNumber    string
+	DisplayName string // Displayname, used when the full name is empty
+}
+
+// Result is the name of a course and how it was obtained
+type Result struct {
+	Name     string // Name in the chosen language, followed by its year and semester as written in the full name
+	Spanish  string
+	English  string
+	Year     string // Academic year, e.g. 21/22, empty if not found
+	Semester string // Semester as written in the name, e.g. 2C or S2, empty if not found
+	Source   string // Pattern, fallback or alias the name comes from
+}
+
+// Explain describes how the name was obtained
+func (r Result) Explain() string {
+	parts := []string{r.Source}
+	if r.Spanish != "" {
+		parts = append(parts, fmt.Sprintf("spanish %q", r.Spanish))
+	}
+	if r.English != "" {
+		parts = append(parts, fmt.Sprintf("english %q", r.English))
+	}
+	if r.Year != "" {
+		parts = append(parts, "year "+r.Year)
+	}
+	if r.Semester != "" {
+		parts = append(parts, "semester "+r.Semester)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// pattern is a known format of the names of UC3M courses. The named groups es, en, year and sem are extracted,
+// and es_suffix and en_suffix keep the year and semester that follow each name as they are written.
+type pattern struct {
+	name        string
+	description string
+	regex       *regexp.Regexp
+}
+
+const (
+	yearExpr     = `\d{2}(?:\d{2})?[/-]\d{2}(?:\d{2})?`
+	semesterExpr = `[12][CS]|S[12]|C[12]|A`
+)
+
+// patterns are checked in order, the first one that matches is used
+var patterns = []pattern{
+	{
+		name:        "multilang",
+		description: `Moodle multilang spans: <span lang="es" class="multilang">…</span><span lang="en" class="multilang">…</span>`,
+		regex:       regexp.MustCompile(`(?is)^\s*<span[^>]*lang="es"[^>]*>(?P<es>.*?)</span>\s*<span[^>]*lang="en"[^>]*>(?P<en>.*?)</span>\s*$`),
+	},
+	{
+		name:        "mlang",
+		description: "Moodle mlang tags: {mlang es}…{mlang}{mlang en}…{mlang}",
+		regex:       regexp.MustCompile(`(?is)^\s*\{mlang es\}(?P<es>.*?)\{mlang\}\s*\{mlang en\}(?P<en>.*?)\{mlang\}\s*$`),
+	},
+	{
+		name:        "bilingual",
+		description: "Spanish and English names with year and semester: Tecnología de Computadores 21/22-2C Computer Technology 21/22-S2",
+		regex:       regexp.MustCompile(`^(?P<es>.+?)(?P<es_suffix>\s*(?P<year>` + yearExpr + `)-(?P<sem>` + semesterExpr + `))\s*(?P<en>\D.*?)(?P<en_suffix>\s*` + yearExpr + `-(?:` + semesterExpr + `))\s*$`),
+	},
+	{
+		name:        "spanish-semester",
+		description: "Spanish name with year and semester: Cálculo 23/24-1C",
+		regex:       regexp.MustCompile(`^(?P<es>.+?)(?P<es_suffix>\s*(?P<year>` + yearExpr + `)-(?P<sem>` + semesterExpr + `))\s*$`),
+	},
+	{
+		name:        "bilingual-no-year",
+		description: "Spanish and English names with a semester and no year: Cálculo-1C Calculus-S1",
+		regex:       regexp.MustCompile(`^(?P<es>.+?)(?P<es_suffix>-(?P<sem>` + semesterExpr + `))\s+(?P<en>\D.*?)(?P<en_suffix>-(?:` + semesterExpr + `))\s*$`),
+	},
+	{
+		name:        "year-suffix",
+		description: "Name followed by the academic year, as in masters' courses: Máster en Ciberseguridad 2023/2024",
+		regex:       regexp.MustCompile(`^(?P<es>.+?)(?P<es_suffix>\s+\(?(?P<year>` + yearExpr + `)\)?)\s*$`),
+	},
+	{
+		name:        "slash",
+		description: "Spanish and English names separated by a spaced slash: Cálculo / Calculus",
+		regex:       regexp.MustCompile(`^(?P<es>[^/]+?)\s+/\s+(?P<en>[^/]+?)\s*$`),
+	},
+}
+
+// Patterns describes the known formats, in the order they are checked
+func Patterns() []string {
+	descriptions := make([]string, 0, len(patterns))
+	for _, p := range patterns {
+		descriptions = append(descriptions, fmt.Sprintf("%s: %s", p.name, p.description))
+	}
+	return descriptions
+}
+
+// Parser derives the names of the courses
+type Parser struct {
+	Aliases map[string]string // Names chosen by the user, keyed by course ID
+}
+
+// Parse returns the name of a course in the given language. The aliases take priority over the
+// patterns; if no pattern matches, the full name is used and, if it is empty, the short name, the
+// ID number or the display name, in that order. The year and semester are kept in the name, so the
+// folders of the courses don't change; they are also available in Year and Semester.
+func (p *Parser) Parse(input Input, language int) Result {
+	if p != nil {
+		if alias, ok := p.Aliases[input.ID]; ok && strings.TrimSpace(alias) != "" {
+			return Result{Name: strings.TrimSpace(alias), Source: "alias"}
+		}
+	}
+
+	fullName := strings.TrimSpace(input.FullName)
+	for _, pat := range patterns {
+		match := pat.regex.FindStringSubmatch(fullName)
+		if match == nil {
+			continue
+		}
+		result := Result{Source: "pattern " + pat.name}
+		suffixes := make(map[int]string)
+		for i, group := range pat.regex.SubexpNames() {
+			value := clean(match[i])
+			switch group {
+			case "es":
+				result.Spanish = value
+			case "en":
+				result.English = value
+			case "year":
+				result.Year = value
+			case "sem":
+				result.Semester = value
+			case "es_suffix":
+				suffixes[Spanish] = spacesRegex.ReplaceAllString(match[i], " ")
+			case "en_suffix":
+				suffixes[English] = spacesRegex.ReplaceAllString(match[i], " ")
+			}
+		}
+		// Names such as "Historia 1900-2000" contain years that are not an academic year
+		if (result.Spanish == "" && result.English == "") || (result.Year != "" && !isAcademicYear(result.Year)) {
+			continue
+		}
+		result.Name = result.localized(language, suffixes)
+		return result
+	}
+
+	fallbacks := []struct {
+		source string
+		value  string
+	}{
+		{"full name, no pattern matched", fullName},
+		{"short name", input.ShortName},
+		{"ID number", input.IDNumber},
+		{"display name", input.DisplayName},
+	}
+	for _, fallback := range fallbacks {
+		if name := clean(fallback.value); name != "" {
+			return Result{Name: name, Source: fallback.source}
+		}
+	}
+	return Result{Name: input.ID, Source: "course ID, the course has no name"}
+}
+
+// localized returns the name in the language, or in the other one if it is missing, followed by its suffix
+func (r *Result) localized(language int, suffixes map[int]string) string {
+	if language == English && r.English != "" {
+		return r.English + suffixes[English]
+	}
+	if r.Spanish != "" {
+		if language == English {
+			r.Source += ", no English name"
+		}
+		return r.Spanish + suffixes[Spanish]
+	}
+	if language == Spanish {
+		r.Source += ", no Spanish name"
+	}
+	return r.English + suffixes[English]
+}
+
+// isAcademicYear reports whether the year is made of two consecutive years, e.g. 21/22 or 2023/2024
+func isAcademicYear(year string) bool {
+	first, second, found := strings.Cut(strings.ReplaceAll(year, "-", "/"), "/")
+	if !found {
+		return false
+	}
+	start, err1 := strconv.Atoi(first)
+	end, err2 := strconv.Atoi(second)
+	if err1 != nil || err2 != nil {
+		return false
+	}
+	return (start+1)%100 == end%100
+}
+
+var (
+	tagRegex    = regexp.MustCompile(`<[^>]*>`)
+	spacesRegex = regexp.MustCompile(`\s+`)
+)
+
+// clean removes the HTML tags and entities and the repeated spaces
+func clean(name string) string {
+	name = html.UnescapeString(tagRegex.ReplaceAllString(name, ""))
+	name = spacesRegex.ReplaceAllString(name, " ")
+	return strings.Trim(name, " -")
+}
@@ -0,0 +1,201 @@
+package coursename
+
+import "testing"
+
+func TestParsePatterns(t *testing.T) {
+	tests := []struct {
+		name     string
+		fullName string
+		language int
+		want     Result
+	}{
+		{
+			name:     "multilang spanish",
+			fullName: `<span lang="es" class="multilang">Cálculo</span><span lang="en" class="multilang">Calculus</span>`,
+			language: Spanish,
+			want:     Result{Name: "Cálculo", Spanish: "Cálculo", English: "Calculus", Source: "pattern multilang"},
+		},
+		{
+			name:     "multilang english",
+			fullName: `<span lang="es" class="multilang">Cálculo</span> <span lang="en" class="multilang">Calculus</span>`,
+			language: English,
+			want:     Result{Name: "Calculus", Spanish: "Cálculo", English: "Calculus", Source: "pattern multilang"},
+		},
+		{
+			name:     "mlang",
+			fullName: "{mlang es}Física{mlang}{mlang en}Physics{mlang}",
+			language: English,
+			want:     Result{Name: "Physics", Spanish: "Física", English: "Physics", Source: "pattern mlang"},
+		},
+		{
+			name:     "bilingual",
+			fullName: "Tecnología de Computadores 21/22-2C Computer Technology 21/22-S2",
+			language: Spanish,
+			want: Result{Name: "Tecnología de Computadores 21/22-2C", Spanish: "Tecnología de Computadores", English: "Computer Technology",
+				Year: "21/22", Semester: "2C", Source: "pattern bilingual"},
+		},
+		{
+			name:     "bilingual english",
+			fullName: "Tecnología de Computadores 21/22-2C Computer Technology 21/22-S2",
+			language: English,
+			want: Result{Name: "Computer Technology 21/22-S2", Spanish: "Tecnología de Computadores", English: "Computer Technology",
+				Year: "21/22", Semester: "2C", Source: "pattern bilingual"},
+		},
+		{
+			name:     "spanish with semester",
+			fullName: "Cálculo 23/24-1C",
+			language: Spanish,
+			want:     Result{Name: "Cálculo 23/24-1C", Spanish: "Cálculo", Year: "23/24", Semester: "1C", Source: "pattern spanish-semester"},
+		},
+		{
+			name:     "spanish with semester asked in english",
+			fullName: "Cálculo 23/24-1C",
+			language: English,
+			want:     Result{Name: "Cálculo 23/24-1C", Spanish: "Cálculo", Year: "23/24", Semester: "1C", Source: "pattern spanish-semester, no English name"},
+		},
+		{
+			name:     "bilingual without year",
+			fullName: "Cálculo-1C Calculus-S1",
+			language: English,
+			want:     Result{Name: "Calculus-S1", Spanish: "Cálculo", English: "Calculus", Semester: "1C", Source: "pattern bilingual-no-year"},
+		},
+		{
+			name:     "year suffix",
+			fullName: "Máster en Ciberseguridad 2023/2024",
+			language: Spanish,
+			want:     Result{Name: "Máster en Ciberseguridad 2023/2024", Spanish: "Máster en Ciberseguridad", Year: "2023/2024", Source: "pattern year-suffix"},
+		},
+		{
+			name:     "year suffix in parentheses",
+			fullName: "Máster en Ciberseguridad (23-24)",
+			language: Spanish,
+			want:     Result{Name: "Máster en Ciberseguridad (23-24)", Spanish: "Máster en Ciberseguridad", Year: "23-24", Source: "pattern year-suffix"},
+		},
+		{
+			name:     "slash",
+			fullName: "Cálculo / Calculus",
+			language: English,
+			want:     Result{Name: "Calculus", Spanish: "Cálculo", English: "Calculus", Source: "pattern slash"},
+		},
+		{
+			name:     "range of years is not an academic year",
+			fullName: "Historia 1900-2000",
+			language: Spanish,
+			want:     Result{Name: "Historia 1900-2000", Source: "full name, no pattern matched"},
+		},
+		{
+			name:     "entities and tags are removed",
+			fullName: "Programaci&oacute;n <b>Avanzada</b>  23/24-2C",
+			language: Spanish,
+			want:     Result{Name: "Programación Avanzada 23/24-2C", Spanish: "Programación Avanzada", Year: "23/24", Semester: "2C", Source: "pattern spanish-semester"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := (&Parser{}).Parse(Input{ID: "1", FullName: tt.fullName}, tt.language)
+			if got != tt.want {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.fullName, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFallbacks(t *testing.T) {
+	tests := []struct {
+		name  string
+		input Input
+		want  Result
+	}{
+		{"full name", Input{ID: "1", FullName: "Trabajo Fin de Grado", ShortName: "TFG"}, Result{Name: "Trabajo Fin de Grado", Source: "full name, no pattern matched"}},
+		{"short name", Input{ID: "1", ShortName: " TFG ", IDNumber: "2024-TFG"}, Result{Name: "TFG", Source: "short name"}},
+		{"ID number", Input{ID: "1", IDNumber: "2024-TFG", DisplayName: "Display"}, Result{Name: "2024-TFG", Source: "ID number"}},
+		{"display name", Input{ID: "1", FullName: "  ", DisplayName: "Display"}, Result{Name: "Display", Source: "display name"}},
+		{"course ID", Input{ID: "1"}, Result{Name: "1", Source: "course ID, the course has no name"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := (&Parser{}).Parse(tt.input, Spanish)
+			if got != tt.want {
+				t.Errorf("Parse(%+v) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAliases(t *testing.T) {
+	parser := &Parser{Aliases: map[string]string{"1": " Cálculo I ", "2": "  "}}
+	input := Input{ID: "1", FullName: "Cálculo 23/24-1C"}
+
+	if got, want := parser.Parse(input, English), (Result{Name: "Cálculo I", Source: "alias"}); got != want {
+		t.Errorf("Parse with an alias = %+v, want %+v", got, want)
+	}
+
+	// An empty alias is ignored
+	input.ID = "2"
+	if got := parser.Parse(input, Spanish); got.Name != "Cálculo 23/24-1C" || got.Source != "pattern spanish-semester" {
+		t.Errorf("Parse with an empty alias = %+v, want the name of the pattern", got)
+	}
+
+	// A nil parser has no aliases
+	var nilParser *Parser
+	if got := nilParser.Parse(Input{ID: "1", FullName: "Cálculo 23/24-1C"}, Spanish); got.Name != "Cálculo 23/24-1C" {
+		t.Errorf("Parse with a nil parser = %+v, want the name of the pattern", got)
+	}
+}
+
+// The folders of the courses are named after Name, which must keep the names of previous versions
+func TestParseKeepsPreviousNames(t *testing.T) {
+	tests := []struct {
+		fullName string
+		language int
+		want     string
+	}{
+		{"Cálculo 23/24-1C", Spanish, "Cálculo 23/24-1C"},
+		{"Tecnología de Computadores 21/22-2C Computer Technology 21/22-S2", Spanish, "Tecnología de Computadores 21/22-2C"},
+		{"Tecnología de Computadores 21/22-2C Computer Technology 21/22-S2", English, "Computer Technology 21/22-S2"},
+		{"Sistemas Operativos-2C Operating Systems-S2", Spanish, "Sistemas Operativos-2C"},
+		{"Máster en Ciberseguridad 2023/2024", Spanish, "Máster en Ciberseguridad 2023/2024"},
+		{"Trabajo Fin de Grado", Spanish, "Trabajo Fin de Grado"},
+	}
+	for _, tt := range tests {
+		if got := (&Parser{}).Parse(Input{ID: "1", FullName: tt.fullName}, tt.language).Name; got != tt.want {
+			t.Errorf("Parse(%q).Name = %q, want %q", tt.fullName, got, tt.want)
+		}
+	}
+}
+
+func TestIsAcademicYear(t *testing.T) {
+	tests := []struct {
+		year string
+		want bool
+	}{
+		{"21/22", true},
+		{"2023/2024", true},
+		{"23-24", true},
+		{"2023-24", true},
+		{"99/00", true},
+		{"21/23", false},
+		{"1900-2000", false},
+		{"2024", false},
+		{"ab/cd", false},
+	}
+	for _, tt := range tests {
+		if got := isAcademicYear(tt.year); got != tt.want {
+			t.Errorf("isAcademicYear(%q) = %v, want %v", tt.year, got, tt.want)
+		}
+	}
+}
+
+func TestPatternsAreDescribed(t *testing.T) {
+	descriptions := Patterns()
+	if len(descriptions) != len(patterns) {
+		t.Fatalf("Patterns() returned %d descriptions, want %d", len(descriptions), len(patterns))
+	}
+	for i, description := range descriptions {
+		if description == "" || patterns[i].description == "" {
+			t.Errorf("pattern %q has no description", patterns[i].name)
+		}
+	}
+}
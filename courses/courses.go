@@ -3,23 +3,25 @@ package courses
 import (
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"os"
-	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/charmbracelet/bubbles/key"
-	"github.com/charmbracelet/bubbles/viewport"
 	tea "github.com/charmbracelet/bubbletea"
-	"github.com/fatih/color"
+	"github.com/charmbracelet/lipgloss"
 
+	coursename "github.com/Astrak00/AGDownloader/coursename"
+	logging "github.com/Astrak00/AGDownloader/logging"
 	types "github.com/Astrak00/AGDownloader/types"
 )
 
 // GetCourses obtains the courses, the localized name and ID, given a userID
 // Returns a slice of courses
-func GetCourses(token string, userID string, language int) (types.Courses, error) {
-	fmt.Println("Fetching courses from AulaGlobal...")
+func GetCourses(token string, userID string, language int, names *coursename.Parser) (types.Courses, error) {
+	slog.Info("Fetching courses from AulaGlobal")
 
 	url := fmt.Sprintf(
 		"https://%s%s?wstoken=%s&wsfunction=core_enrol_get_users_courses&userid=%s&moodlewsrestformat=json",
@@ -41,29 +43,53 @@ func GetCourses(token string, userID string, language int) (types.Courses, error
 	// Get the names and IDs of the courses
 	courses := make([]types.Course, 0, len(userParsed))
 	for _, course := range userParsed {
-		courseName := extractCourseNameByLanguage(course.Fullname, language)
-		if !containsInvalidNames(courseName) {
-			courses = append(courses, types.Course{Name: courseName, ID: strconv.Itoa(course.ID)})
-		}
+		name := names.Parse(coursename.Input{
+			ID:          strconv.Itoa(course.ID),
+			FullName:    course.Fullname,
+			ShortName:   course.Shortname,
+			IDNumber:    course.Idnumber,
+			DisplayName: course.Displayname,
+		}, language)
+		courses = append(courses, types.Course{
+			Name:      name.Name,
+			ID:        strconv.Itoa(course.ID),
+			ShortName: course.Shortname,
+			FullName:  course.Fullname,
+			Category:  strconv.Itoa(course.Category),
+			StartDate: int64(course.Startdate),
+			EndDate:   unixTime(course.Enddate),
+			Hidden:    course.Hidden,
+			Favourite: course.Isfavourite,
+
+			NameSource: name.Explain(),
+		})
 	}
 
-	defer color.Green("Number of courses found: %d\n", len(courses))
+	slog.Info("Courses found", "count", len(courses))
 	return courses, nil
 }
 
-// GetCoursesByTimeline obtains all courses (current, past, and future) using the timeline classification API
+// unixTime converts a timestamp decoded into an interface (the API may return null) to an integer
+func unixTime(value any) int64 {
+	if number, ok := value.(float64); ok {
+		return int64(number)
+	}
+	return 0
+}
+
+// GetCoursesByTimeline obtains the courses of a timeline classification (e.g. "all", "inprogress" or "past")
 // This API doesn't require a userID, only the wstoken
 // Returns a slice of courses
-func GetCoursesByTimeline(token string, language int) (types.Courses, error) {
-	fmt.Println("Fetching all courses (current, past, and future) from AulaGlobal...")
+func GetCoursesByTimeline(token string, classification string, language int, names *coursename.Parser) (types.Courses, error) {
+	slog.Info("Fetching courses from AulaGlobal using the timeline", "classification", classification)
 
 	url := fmt.Sprintf(
-		"https://%s%s?wstoken=%s&wsfunction=core_course_get_enrolled_courses_by_timeline_classification&classification=all&moodlewsrestformat=json",
+		"https://%s%s?wstoken=%s&wsfunction=core_course_get_enrolled_courses_by_timeline_classification&classification=%s&moodlewsrestformat=json",
 		types.Domain,
 		types.Webservice,
 		token,
+		classification,
 	)
-	fmt.Println("aaaa" + url)
 
 	jsonData := types.GetJson(url)
 
@@ -77,173 +103,95 @@ func GetCoursesByTimeline(token string, language int) (types.Courses, error) {
 	// Get the names and IDs of the courses
 	courses := make([]types.Course, 0, len(timelineParsed.Courses))
 	for _, course := range timelineParsed.Courses {
-		courseName := extractCourseNameFromFullDisplay(course.Fullnamedisplay, language)
-		if !containsInvalidNames(courseName) {
-			courses = append(courses, types.Course{Name: courseName, ID: strconv.Itoa(course.ID)})
+		fullName := course.Fullnamedisplay
+		if fullName == "" {
+			fullName = course.Fullname
 		}
+		name := names.Parse(coursename.Input{
+			ID:        strconv.Itoa(course.ID),
+			FullName:  fullName,
+			ShortName: course.Shortname,
+			IDNumber:  course.Idnumber,
+		}, language)
+		courses = append(courses, types.Course{
+			Name:      name.Name,
+			ID:        strconv.Itoa(course.ID),
+			ShortName: course.Shortname,
+			FullName:  course.Fullname,
+			Category:  course.Coursecategory,
+			StartDate: int64(course.Startdate),
+			EndDate:   int64(course.Enddate),
+			Hidden:    course.Hidden,
+			Favourite: course.Isfavourite,
+
+			NameSource: name.Explain(),
+		})
 	}
 
-	defer color.Green("Number of courses found: %d\n", len(courses))
+	slog.Info("Courses found", "count", len(courses))
 	return courses, nil
 }
 
-// Check if the name of the course contains invalid names that should not be downloaded
-func containsInvalidNames(name string) bool {
-	invalidCourseNames := []string{
-		"Convenio", "Delegación", "Secretaría",
-		"Student Room", "Sala de Estudiantes", "Bachelor",
-	}
+// StatsFunc obtains the number of files of a course and their total size
+type StatsFunc func(courseID string) (files int, size int64, err error)
 
-	for _, invalidName := range invalidCourseNames {
-		if strings.Contains(name, invalidName) {
-			return true
-		}
-	}
-	return false
+// SelectorOptions configures the interactive course selector
+type SelectorOptions struct {
+	ShowExcluded bool            // Show the excluded courses, greyed out, after the others
+	Previous     map[string]bool // IDs of the courses selected in the previous run, selected from the start
+	Stats        StatsFunc       // Fills the columns of files and size of the highlighted course, nil leaves them empty
 }
 
-// Get the names of the courses in Spanish and English
-// This function localizes the names of the courses in Spanish and English
-func extractCourseNameByLanguage(name string, lang int) string {
-	// Define the first group of separators with priority.
-	firstGroup := []string{"-1C", "-2C", "-1S", "-2S"}
-
-	// Iterate over the first group to find the earliest separator.
-	for _, sep := range firstGroup {
-		if idx := strings.Index(name, sep); idx > 0 {
-			if lang == 1 {
-				return name[:idx+len(sep)]
-			}
-			return name[idx+len(sep):]
-		}
+// SelectCoursesInteractive is the entry point for prompting the user:
+// The courses given with --courses are matched with Match and the user is only prompted if there are none.
+// The excluded courses are never selected with "all", only by their ID with --courses, and are only shown in the selector,
+// greyed out, if opts.ShowExcluded is set.
+func SelectCoursesInteractive(language int, selectedCourses []string, courses types.Courses, opts SelectorOptions) ([]types.Course, error) {
+	if slices.Contains(selectedCourses, "all") {
+		return courses.Included(), nil
 	}
-
-	// Define the second group of separators.
-	secondGroup := []string{"Bachelor", "Student", "Convenio-Bilateral s"}
-
-	// Iterate over the second group to find the earliest separator.
-	for _, sep := range secondGroup {
-		if idx := strings.Index(name, sep); idx != -1 {
-			if lang == 1 {
-				return name[:idx]
-			}
-			return name[idx:]
-		}
+	if len(selectedCourses) != 0 {
+		return Match(courses, selectedCourses)
 	}
 
-	// If no separators are found, return the original name.
-	return name
+	// Use our Bubble Tea-based checkboxes
+	prompt := "Select the courses you want to download\n"
+	return checkboxesCourses(prompt, selectorRows(courses, opts.ShowExcluded), opts), nil
 }
 
-// extractCourseNameFromFullDisplay extracts the course name from the fullnamedisplay field
-// fullnamedisplay format: "Spanish Name YY/YY-#C English Name YY/YY-S#"
-// Example: "Tecnología de Computadores 21/22-2C Computer Technology 21/22-S2"
-// This function extracts just the course name without the year/semester info
-func extractCourseNameFromFullDisplay(fullDisplay string, lang int) string {
-	// Regex that indicates the end of course name and start of year/semester (e.g., " 21", " 22", etc.)
-	re := regexp.MustCompile(` 2\d`)
-
-	// Find the first occurrence of a year separator
-	firstYearIdx := -1
-	loc := re.FindStringIndex(fullDisplay)
-	if loc != nil {
-		firstYearIdx = loc[0]
-	}
-
-	// If no year separator found, return the original name
-	if firstYearIdx == -1 {
-		return fullDisplay
-	}
-
-	// Extract the part before the first year (Spanish name + year/semester + English name + year/semester)
-	// Example: "Tecnología de Computadores 21/22-2CComputer Technology 21/22-S2"
-	// We need to find the Spanish and English parts
-
-	// Find all year positions to split Spanish and English sections
-	spanishEnd := firstYearIdx
-
-	// Look for the separator between Spanish and English
-	// Pattern: Spanish Name YY/YY-#C English Name
-	// The separator is typically "-#C" followed by a capital letter (start of English name)
-	separatorPattern := []string{"-1C", "-2C", "-1S", "-2S"}
-	englishStart := -1
-
-	for _, sep := range separatorPattern {
-		if idx := strings.Index(fullDisplay, sep); idx != -1 && idx < len(fullDisplay)-len(sep) {
-			// Check if there's a capital letter or space after the separator
-			afterSep := idx + len(sep)
-			if afterSep < len(fullDisplay) {
-				// English name starts after the separator
-				englishStart = afterSep
-				// spanishEnd = idx + len(sep)
-				break
-			}
-		}
-	}
-
-	if englishStart == -1 {
-		// Couldn't find the split, extract just the name before year
-		courseName := strings.TrimSpace(fullDisplay[:spanishEnd])
-		return courseName
-	}
-
-	// Extract Spanish or English name based on language preference
-	if lang == 1 { // Spanish
-		// Extract the part before the first year (which is the Spanish course name)
-		spanishName := strings.TrimSpace(fullDisplay[:firstYearIdx])
-		return spanishName
-	} else { // English
-		// Find where English name ends (before its year)
-		englishPart := fullDisplay[englishStart:]
-		englishEnd := -1
-		loc := re.FindStringIndex(englishPart)
-		if loc != nil {
-			englishEnd = loc[0]
-		}
-		if englishEnd != -1 {
-			return strings.TrimSpace(englishPart[:englishEnd])
+// selectorRows lists the courses grouped by academic year, newest first, if there is more than one.
+// The excluded courses are listed after the others, if they are shown.
+func selectorRows(courses types.Courses, showExcluded bool) []row {
+	included := sortByYear(courses.Included())
+	grouped := len(included) > 0 && yearHeader(included[0]) != yearHeader(included[len(included)-1])
+	rows := make([]row, 0, len(courses))
+	for i, course := range included {
+		if grouped && (i == 0 || yearHeader(course) != yearHeader(included[i-1])) {
+			rows = append(rows, row{header: yearHeader(course)})
 		}
-		return strings.TrimSpace(englishPart)
+		rows = append(rows, row{course: course})
 	}
-}
-
-// SelectCoursesInteractive is the entry point for prompting the user:
-func SelectCoursesInteractive(language int, selectedCourses []string, courses types.Courses) []types.Course {
-	if len(selectedCourses) != 0 && selectedCourses[0] == "all" {
-		return courses
-	} else if len(selectedCourses) == 0 {
-		// Use our Bubble Tea-based checkboxes
-		prompt := "Select the courses you want to download\n"
-		coursesName := courses.GetCoursesName()
 
-		selectedCourses = checkboxesCourses(prompt, coursesName)
-	}
-
-	coursesToDownload := make([]types.Course, 0, len(selectedCourses))
-	courseMap := make(map[string]types.Course)
-	for _, c := range courses {
-		courseMap[c.Name] = c
-	}
-
-	for _, courseName := range selectedCourses {
-		if course, exists := courseMap[courseName]; exists {
-			coursesToDownload = append(coursesToDownload, course)
+	if showExcluded {
+		for _, course := range courses {
+			if course.Excluded != "" {
+				rows = append(rows, row{course: course})
+			}
 		}
 	}
-	return coursesToDownload
+	return rows
 }
 
 // checkboxesCourses uses Bubble Tea to allow the user to interactively
 // select items by pressing up/down to move and space to toggle selection.
-func checkboxesCourses(label string, opts []string) []string {
-	m := initialModel(label, opts)
+func checkboxesCourses(label string, rows []row, opts SelectorOptions) []types.Course {
+	m := initialModel(label, rows, opts)
 
 	// Run the Bubble Tea program
 	p := tea.NewProgram(m)
 	finalModel, err := p.Run()
 	if err != nil {
-		fmt.Println("Error running Bubble Tea program:", err)
-		os.Exit(1)
+		logging.Fatal("Error running the course selector", logging.KeyError, err)
 	}
 
 	// Extract the selected items
@@ -251,7 +199,7 @@ func checkboxesCourses(label string, opts []string) []string {
 		if mFinal.cancelled {
 			os.Exit(0)
 		}
-		return mFinal.selectedItems()
+		return mFinal.selectedCourses()
 	}
 	return nil
 }
@@ -259,35 +207,80 @@ func checkboxesCourses(label string, opts []string) []string {
 // ----------------------------------------------------
 // Below is a minimal Bubble Tea model for multi-select
 // ----------------------------------------------------
+
+// row is a line of the selector: a course or the title of a group of courses
+type row struct {
+	course types.Course
+	header string // Title of the group, empty for the rows of courses
+}
+
+// selectable reports whether the row can be selected, i.e. it is a course that isn't excluded
+func (r row) selectable() bool {
+	return r.header == "" && r.course.Excluded == ""
+}
+
+// courseStats are the number of files and size of a course, fetched while the selector is shown
+type courseStats struct {
+	files int
+	size  int64
+	err   error
+}
+
+// statsMsg delivers the stats of a course to the model
+type statsMsg struct {
+	courseID string
+	stats    courseStats
+}
+
 type model struct {
 	label     string
-	cursor    int          // which item is currently highlighted
-	items     []string     // all course names
-	selected  map[int]bool // track selected items by index
-	done      bool         // signals we've pressed Enter
-	cancelled bool         // signals we've pressed Quit
-	viewport  viewport.Model
+	rows      []row                  // all the courses and the titles of their groups
+	selected  map[int]bool           // track selected rows by index
+	visible   []int                  // indexes of the rows that match the search
+	cursor    int                    // position in visible of the highlighted row
+	offset    int                    // position in visible of the first row on screen
+	height    int                    // height of the terminal, 0 until it is known
+	query     string                 // text the courses are filtered by
+	searching bool                   // the keys pressed are typed into the query
+	stats     map[string]courseStats // stats of the courses, keyed by ID
+	requested map[string]bool        // courses whose stats were requested, keyed by ID
+	fetch     StatsFunc
+	done      bool // signals we've pressed Enter
+	cancelled bool // signals we've pressed Quit
 	keymap    keymap
 }
 
+// excludedStyle greys out the excluded courses
+var excludedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("241"))
+
+// headerStyle highlights the titles of the groups of courses and of the columns
+var headerStyle = lipgloss.NewStyle().Bold(true)
+
 // Define key bindings we care about
 type keymap struct {
-	Up    key.Binding
-	Down  key.Binding
-	Space key.Binding
-	Enter key.Binding
-	Quit  key.Binding
-	All   key.Binding
-	None  key.Binding
+	Up       key.Binding
+	Down     key.Binding
+	PageUp   key.Binding
+	PageDown key.Binding
+	Space    key.Binding
+	Enter    key.Binding
+	Quit     key.Binding
+	All      key.Binding
+	None     key.Binding
+	Search   key.Binding
+	Clear    key.Binding
 }
 
 // initialModel sets up the model with defaults
-func initialModel(label string, items []string) model {
+func initialModel(label string, rows []row, opts SelectorOptions) model {
 	m := model{
-		label:    label,
-		items:    items,
-		selected: make(map[int]bool),
-		cursor:   0,
+		label:     label,
+		rows:      rows,
+		selected:  make(map[int]bool),
+		stats:     make(map[string]courseStats),
+		requested: make(map[string]bool),
+		fetch:     opts.Stats,
+		cursor:    0,
 		keymap: keymap{
 			Up: key.NewBinding(
 				key.WithKeys("up", "k"),
@@ -297,6 +290,14 @@ func initialModel(label string, items []string) model {
 				key.WithKeys("down", "j"),
 				key.WithHelp("↓/j", "move down"),
 			),
+			PageUp: key.NewBinding(
+				key.WithKeys("pgup"),
+				key.WithHelp("pgup", "previous page"),
+			),
+			PageDown: key.NewBinding(
+				key.WithKeys("pgdown"),
+				key.WithHelp("pgdown", "next page"),
+			),
 			Space: key.NewBinding(
 				key.WithKeys(" "),
 				key.WithHelp("space", "toggle selection"),
@@ -317,37 +318,77 @@ func initialModel(label string, items []string) model {
 				key.WithKeys("0", "left"),
 				key.WithHelp("0", "select none"),
 			),
+			Search: key.NewBinding(
+				key.WithKeys("/"),
+				key.WithHelp("/", "search"),
+			),
+			Clear: key.NewBinding(
+				key.WithKeys("esc"),
+				key.WithHelp("esc", "clear the search"),
+			),
 		},
 	}
 
-	m.viewport = viewport.New(0, 0)
+	// The courses of the previous run start selected
+	for i, r := range rows {
+		if r.selectable() && opts.Previous[r.course.ID] {
+			m.selected[i] = true
+		}
+	}
+	m.filter()
 	return m
 }
 
-// Init is called when the program starts. We don't need to do anything here.
+// Init fetches the stats of the first highlighted course
 func (m model) Init() tea.Cmd {
-	return nil
+	return m.fetchHighlighted()
+}
+
+// fetchHighlighted fetches the stats of the highlighted course, if they were not requested yet. They are
+// only fetched for the courses the user goes through, instead of sending a request for every course at once.
+func (m model) fetchHighlighted() tea.Cmd {
+	if m.fetch == nil || len(m.visible) == 0 {
+		return nil
+	}
+	r := m.rows[m.visible[m.cursor]]
+	if !r.selectable() || m.requested[r.course.ID] {
+		return nil
+	}
+	m.requested[r.course.ID] = true
+	courseID, fetch := r.course.ID, m.fetch
+	return func() tea.Msg {
+		files, size, err := fetch(courseID)
+		return statsMsg{courseID: courseID, stats: courseStats{files: files, size: size, err: err}}
+	}
 }
 
 // Update handles incoming messages (keypresses, window size changes, etc.)
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
 
+	case statsMsg:
+		m.stats[msg.courseID] = msg.stats
+
 	case tea.KeyMsg:
+		if m.searching {
+			return m.updateSearch(msg)
+		}
 		switch {
 		// Move cursor up
 		case key.Matches(msg, m.keymap.Up):
-			if m.cursor > 0 {
-				m.cursor--
-			}
+			m.move(-1)
 		// Move cursor down
 		case key.Matches(msg, m.keymap.Down):
-			if m.cursor < len(m.items)-1 {
-				m.cursor++
-			}
+			m.move(1)
+		case key.Matches(msg, m.keymap.PageUp):
+			m.move(-max(m.pageSize(), 1))
+		case key.Matches(msg, m.keymap.PageDown):
+			m.move(max(m.pageSize(), 1))
 		// Toggle selection
 		case key.Matches(msg, m.keymap.Space):
-			m.selected[m.cursor] = !m.selected[m.cursor]
+			if len(m.visible) > 0 && m.rows[m.visible[m.cursor]].selectable() {
+				m.selected[m.visible[m.cursor]] = !m.selected[m.visible[m.cursor]]
+			}
 		// Confirm (Enter) -> exit
 		case key.Matches(msg, m.keymap.Enter):
 			m.done = true
@@ -357,23 +398,135 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.cancelled = true
 			return m, tea.Quit
 
+		// Select all and none only change the courses that match the search
 		case key.Matches(msg, m.keymap.All):
-			for i := range m.items {
-				m.selected[i] = true
+			for _, i := range m.visible {
+				if m.rows[i].selectable() {
+					m.selected[i] = true
+				}
 			}
 		case key.Matches(msg, m.keymap.None):
-			for i := range m.items {
+			for _, i := range m.visible {
 				m.selected[i] = false
 			}
+		case key.Matches(msg, m.keymap.Search):
+			m.searching = true
+		case key.Matches(msg, m.keymap.Clear):
+			m.query = ""
+			m.filter()
 		}
 
 	case tea.WindowSizeMsg:
-		// If the window resizes, update viewport size
-		m.viewport.Width = msg.Width
-		m.viewport.Height = msg.Height
+		// If the window resizes, keep the cursor on screen
+		m.height = msg.Height
+		m.scroll()
 	}
 
-	return m, nil
+	return m, m.fetchHighlighted()
+}
+
+// updateSearch handles the keys while the search is being typed
+func (m model) updateSearch(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.Type {
+	case tea.KeyCtrlC:
+		m.cancelled = true
+		return m, tea.Quit
+	// Enter keeps the courses found, Esc shows all of them again
+	case tea.KeyEnter:
+		m.searching = false
+	case tea.KeyEsc:
+		m.searching = false
+		m.query = ""
+		m.filter()
+	case tea.KeyBackspace:
+		if runes := []rune(m.query); len(runes) > 0 {
+			m.query = string(runes[:len(runes)-1])
+			m.filter()
+		}
+	case tea.KeyUp:
+		m.move(-1)
+	case tea.KeyDown:
+		m.move(1)
+	case tea.KeyRunes, tea.KeySpace:
+		m.query += string(msg.Runes)
+		m.filter()
+	}
+	return m, m.fetchHighlighted()
+}
+
+// filter shows the courses whose name, short name or ID contain the query, ignoring the case and the
+// accents. The titles of the groups are hidden while searching.
+func (m *model) filter() {
+	query := fold(m.query)
+	m.visible = m.visible[:0]
+	for i, r := range m.rows {
+		if query == "" {
+			m.visible = append(m.visible, i)
+			continue
+		}
+		if r.header != "" {
+			continue
+		}
+		if strings.Contains(fold(r.course.Name), query) || strings.Contains(fold(r.course.FullName), query) ||
+			strings.Contains(fold(r.course.ShortName), query) || strings.HasPrefix(r.course.ID, query) {
+			m.visible = append(m.visible, i)
+		}
+	}
+	m.cursor, m.offset = 0, 0
+	m.move(0)
+}
+
+// move moves the cursor by delta rows, skipping the titles of the groups
+func (m *model) move(delta int) {
+	if len(m.visible) == 0 {
+		m.cursor = 0
+		return
+	}
+	target := max(0, min(len(m.visible)-1, m.cursor+delta))
+	direction := 1
+	if delta < 0 {
+		direction = -1
+	}
+	// Look for a course in the direction of the movement, or in the other one at the ends of the list
+	for _, d := range []int{direction, -direction} {
+		for i := target; i >= 0 && i < len(m.visible); i += d {
+			if m.rows[m.visible[i]].header == "" {
+				m.cursor = i
+				m.scroll()
+				return
+			}
+		}
+	}
+}
+
+// pageSize is the number of rows that fit on screen, 0 if the height of the terminal is unknown
+func (m model) pageSize() int {
+	if m.height == 0 {
+		return 0
+	}
+	// The label, the search, the titles of the columns, the position and the help
+	reserved := strings.Count(m.label, "\n") + 7
+	return max(m.height-reserved, 1)
+}
+
+// scroll moves the rows on screen so that the cursor is visible
+func (m *model) scroll() {
+	page := m.pageSize()
+	if page == 0 {
+		m.offset = 0
+		return
+	}
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+		// Show the title of the group of the first course
+		if m.offset > 0 && m.rows[m.visible[m.offset-1]].header != "" {
+			m.offset--
+		}
+	}
+	if m.cursor >= m.offset+page {
+		m.offset = m.cursor - page + 1
+	}
+	m.offset = max(0, min(m.offset, len(m.visible)-page))
 }
 
 // View renders the UI each time Update is called.
@@ -384,10 +537,27 @@ func (m model) View() string {
 	}
 
 	s := m.label + "\n"
+	if m.searching {
+		s += fmt.Sprintf("Search: %s█\n", m.query)
+	} else if m.query != "" {
+		s += fmt.Sprintf("Search: %s\n", m.query)
+	}
+	s += headerStyle.Render(fmt.Sprintf("      %-8s %-8s %6s %10s  %s", "ID", "Year", "Files", "Size", "Name")) + "\n"
+
+	start, end := 0, len(m.visible)
+	if page := m.pageSize(); page > 0 {
+		start, end = m.offset, min(m.offset+page, len(m.visible))
+	}
+	for pos := start; pos < end; pos++ {
+		i := m.visible[pos]
+		r := m.rows[i]
+		if r.header != "" {
+			s += headerStyle.Render(r.header) + "\n"
+			continue
+		}
 
-	for i, choice := range m.items {
 		cursor := " " // no cursor
-		if m.cursor == i {
+		if m.cursor == pos {
 			cursor = ">" // highlight the current line
 		}
 
@@ -396,19 +566,59 @@ func (m model) View() string {
 			checked = "x"
 		}
 
-		// [ ] or [x], plus cursor arrow, plus the course name
-		s += fmt.Sprintf("%s [%s] %s\n", cursor, checked, choice)
+		// [ ] or [x], plus cursor arrow, plus the columns of the course
+		columns := m.columns(r.course)
+		if r.course.Excluded != "" {
+			s += excludedStyle.Render(fmt.Sprintf("%s [-] %s (excluded by %q)", cursor, columns, r.course.Excluded)) + "\n"
+			continue
+		}
+		s += fmt.Sprintf("%s [%s] %s\n", cursor, checked, columns)
+	}
+
+	if len(m.visible) == 0 {
+		s += "No course matches the search\n"
+	}
+	if start > 0 || end < len(m.visible) {
+		s += fmt.Sprintf("(%d-%d of %d)\n", start+1, end, len(m.visible))
+	}
+	if m.searching {
+		s += "\n(type to search, enter to keep the results, esc to clear the search)"
+	} else {
+		s += "\n(↑/↓ or k/j to navigate, pgup/pgdown to scroll, space to toggle, enter to confirm, q to quit)\n(*/→ to select all, ←/0 to select none, / to search, esc to clear the search)"
 	}
-	s += "\n(↑/↓ or k/j to navigate, space to toggle, enter to confirm, q to quit)\n(*/→ to select all, ←/0 to select none)"
 	return s
 }
 
-// selectedItems returns the items that the user marked as selected
-func (m model) selectedItems() []string {
-	results := []string{}
-	for i, selected := range m.selected {
-		if selected {
-			results = append(results, m.items[i])
+// columns formats the ID, academic year, number of files, size and name of a course
+func (m model) columns(course types.Course) string {
+	year := "-"
+	if start, _ := course.AcademicYear(); start != 0 {
+		year = types.FormatAcademicYear(start, "/")
+	}
+
+	files, size := "", ""
+	if m.fetch != nil && course.Excluded == "" {
+		stats, fetched := m.stats[course.ID]
+		switch {
+		case !m.requested[course.ID]:
+			// Fetched once the course is highlighted
+		case !fetched:
+			files, size = "…", "…"
+		case stats.err != nil:
+			files, size = "?", "?"
+		default:
+			files, size = strconv.Itoa(stats.files), types.FormatBytes(stats.size)
+		}
+	}
+	return fmt.Sprintf("%-8s %-8s %6s %10s  %s", course.ID, year, files, size, course.Name)
+}
+
+// selectedCourses returns the courses that the user marked as selected, in the order they are listed
+func (m model) selectedCourses() []types.Course {
+	results := []types.Course{}
+	for i, r := range m.rows {
+		if m.selected[i] {
+			results = append(results, r.course)
 		}
 	}
 	return results
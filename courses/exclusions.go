@@ -0,0 +1,86 @@
+package courses
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	logging "github.com/Astrak00/AGDownloader/logging"
+	types "github.com/Astrak00/AGDownloader/types"
+)
+
+// DefaultExclusions hide the courses that are not subjects, such as the student rooms or the
+// secretary's office. They are used when the configuration file has no "exclude_courses" list.
+var DefaultExclusions = []string{
+	"Convenio", "Delegación", "Secretaría",
+	"Student Room", "Sala de Estudiantes", "Bachelor",
+}
+
+// exclusion is a rule that hides the courses it matches
+type exclusion struct {
+	spec  string
+	match func(course types.Course) bool
+}
+
+// Exclusions hide some courses from the selection
+type Exclusions struct {
+	rules []exclusion
+}
+
+// ParseExclusions parses the exclusion rules: "id:123456" matches a course ID, "regex:^Sala" a regular
+// expression and any other text is searched in the name of the course, as previous versions did.
+// The name is the one shown in the selector, in the chosen language.
+func ParseExclusions(specs []string) (*Exclusions, error) {
+	exclusions := &Exclusions{}
+	for _, spec := range specs {
+		rule := exclusion{spec: spec}
+		switch {
+		case strings.HasPrefix(spec, "id:"):
+			id := strings.TrimSpace(strings.TrimPrefix(spec, "id:"))
+			if id == "" {
+				return nil, fmt.Errorf("invalid course exclusion %q: missing ID", spec)
+			}
+			rule.match = func(course types.Course) bool { return course.ID == id }
+		case strings.HasPrefix(spec, "regex:"):
+			re, err := regexp.Compile(strings.TrimPrefix(spec, "regex:"))
+			if err != nil {
+				return nil, fmt.Errorf("invalid course exclusion %q: %v", spec, err)
+			}
+			rule.match = func(course types.Course) bool {
+				return re.MatchString(course.Name)
+			}
+		default:
+			if strings.TrimSpace(spec) == "" {
+				return nil, fmt.Errorf("invalid course exclusion %q: empty text", spec)
+			}
+			rule.match = func(course types.Course) bool {
+				return strings.Contains(course.Name, spec)
+			}
+		}
+		exclusions.rules = append(exclusions.rules, rule)
+	}
+	return exclusions, nil
+}
+
+// Apply marks the excluded courses with the rule that excluded them and reports them
+func (e *Exclusions) Apply(courses types.Courses) types.Courses {
+	if e == nil {
+		return courses
+	}
+	excluded := 0
+	for i, course := range courses {
+		for _, rule := range e.rules {
+			if rule.match(course) {
+				courses[i].Excluded = rule.spec
+				excluded++
+				slog.Info("Course excluded", logging.KeyCourseID, course.ID, logging.KeyCourseName, course.Name, "rule", rule.spec)
+				break
+			}
+		}
+	}
+	if excluded > 0 {
+		slog.Info("Some courses were excluded by the exclusion list, use --show-excluded to see them in the selector", "count", excluded)
+	}
+	return courses
+}
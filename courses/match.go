@@ -0,0 +1,161 @@
+package courses
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	types "github.com/Astrak00/AGDownloader/types"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Match returns the courses chosen by the selectors of --courses. A selector matches, in this order of
+// priority, the ID of a course, its short name, its whole name or a part of its name. The names are
+// compared ignoring the case and the accents. The excluded courses are only matched by their ID, so an
+// exclusion can be overridden without editing the configuration. Selectors that match no course or several
+// courses are reported together in the error, so that the user can fix all of them at once.
+func Match(courses types.Courses, selectors []string) (types.Courses, error) {
+	matched := make(types.Courses, 0, len(selectors))
+	seen := make(map[string]bool)
+	var errs []error
+	for _, selector := range selectors {
+		selector = strings.TrimSpace(selector)
+		if selector == "" {
+			continue
+		}
+		candidates := matchSelector(courses, selector)
+		switch len(candidates) {
+		case 0:
+			err := fmt.Errorf("no course matches %q", selector)
+			if suggestion := closestCourse(courses.Included(), selector); suggestion != "" {
+				err = fmt.Errorf("%w, did you mean %q?", err, suggestion)
+			}
+			errs = append(errs, err)
+		case 1:
+			if !seen[candidates[0].ID] {
+				seen[candidates[0].ID] = true
+				matched = append(matched, candidates[0])
+			}
+		default:
+			names := make([]string, 0, len(candidates))
+			for _, course := range candidates {
+				names = append(names, fmt.Sprintf("%s (%s)", course.Name, course.ID))
+			}
+			errs = append(errs, fmt.Errorf("%q matches several courses, use one of their IDs: %s", selector, strings.Join(names, ", ")))
+		}
+	}
+	return matched, errors.Join(errs...)
+}
+
+// matchSelector returns the courses matched by the most precise rule that matches any course
+func matchSelector(courses types.Courses, selector string) types.Courses {
+	for _, course := range courses {
+		if course.ID == selector {
+			return types.Courses{course}
+		}
+	}
+
+	folded := fold(selector)
+	rules := []func(course types.Course) bool{
+		func(course types.Course) bool { return fold(course.ShortName) == folded },
+		func(course types.Course) bool { return fold(course.Name) == folded || fold(course.FullName) == folded },
+		func(course types.Course) bool {
+			return strings.Contains(fold(course.Name), folded) || strings.Contains(fold(course.FullName), folded)
+		},
+		// Every word of the selector, in any order, e.g. "sistemas operativos" matches "Diseño de Sistemas Operativos"
+		func(course types.Course) bool {
+			name := fold(course.Name) + " " + fold(course.FullName)
+			for _, word := range strings.Fields(folded) {
+				if !strings.Contains(name, word) {
+					return false
+				}
+			}
+			return true
+		},
+	}
+	for _, rule := range rules {
+		var candidates types.Courses
+		for _, course := range courses.Included() {
+			if rule(course) {
+				candidates = append(candidates, course)
+			}
+		}
+		if len(candidates) > 0 {
+			return candidates
+		}
+	}
+	return nil
+}
+
+// fold prepares a name to be compared: lower case, without accents and with single spaces
+func fold(s string) string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(s) {
+		if !unicode.Is(unicode.Mn, r) {
+			b.WriteRune(unicode.ToLower(r))
+		}
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// closestCourse returns the name of the course most similar to the selector, to suggest it when the
+// selector has a typo. It returns an empty string if no name is similar enough.
+func closestCourse(courses types.Courses, selector string) string {
+	folded := fold(selector)
+	best, bestDistance := "", len([]rune(folded))/3+1
+	for _, course := range courses {
+		if distance := editDistance(fold(course.Name), folded); distance < bestDistance {
+			best, bestDistance = course.Name, distance
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+// ReadSelectors reads the selectors of a --courses-file, one per line.
+// Empty lines and lines starting with # are ignored.
+func ReadSelectors(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the courses file: %v", err)
+	}
+	defer file.Close()
+
+	var selectors []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		selectors = append(selectors, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading the courses file %s: %v", path, err)
+	}
+	return selectors, nil
+}
@@ -0,0 +1,63 @@
+package courses
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	state "github.com/Astrak00/AGDownloader/state"
+	types "github.com/Astrak00/AGDownloader/types"
+)
+
+// selectionFile keeps the courses selected in the last run
+const selectionFile = "selection.json"
+
+type selectionData struct {
+	Courses []string `json:"courses"` // IDs of the selected courses
+}
+
+// LoadSelection returns the IDs of the courses selected in the last run in the download directory.
+// It returns an empty selection if there was no previous run.
+func LoadSelection(root string) (map[string]bool, error) {
+	selection := make(map[string]bool)
+	data, err := os.ReadFile(state.Path(root, selectionFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return selection, nil
+	}
+	if err != nil {
+		return selection, fmt.Errorf("failed to read the previous selection: %v", err)
+	}
+
+	var stored selectionData
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return selection, fmt.Errorf("failed to parse the previous selection: %v", err)
+	}
+	for _, id := range stored.Courses {
+		selection[id] = true
+	}
+	return selection, nil
+}
+
+// SaveSelection stores the selected courses in the download directory, to select them again in the next run
+func SaveSelection(root string, courses []types.Course) error {
+	stored := selectionData{Courses: make([]string, 0, len(courses))}
+	for _, course := range courses {
+		stored.Courses = append(stored.Courses, course.ID)
+	}
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	path := state.Path(root, selectionFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to save the selection: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to save the selection: %v", err)
+	}
+	return nil
+}
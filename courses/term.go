@@ -0,0 +1,110 @@
+package courses
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	logging "github.com/Astrak00/AGDownloader/logging"
+	types "github.com/Astrak00/AGDownloader/types"
+)
+
+// Classifications are the groups of courses the timeline API can return
+var Classifications = []string{"all", "inprogress", "past", "future", "favourites", "hidden", "allincludinghidden"}
+
+// ParseClassification validates a timeline classification
+func ParseClassification(classification string) error {
+	for _, valid := range Classifications {
+		if classification == valid {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown classification %q (%s)", classification, strings.Join(Classifications, ", "))
+}
+
+var yearRegex = regexp.MustCompile(`^(\d{2}|\d{4})(?:[/-](\d{2}|\d{4}))?$`)
+
+// ParseYear parses an academic year such as "2024/25", "2024-2025", "24/25" or "2024",
+// returning the year it starts in. An empty year returns 0.
+func ParseYear(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	parts := yearRegex.FindStringSubmatch(s)
+	if parts == nil {
+		return 0, fmt.Errorf("invalid academic year %q, expected a year such as 2024/25", s)
+	}
+	start, _ := strconv.Atoi(parts[1])
+	if len(parts[1]) == 2 {
+		start += 2000
+	}
+	if parts[2] != "" {
+		end, _ := strconv.Atoi(parts[2])
+		if end%100 != (start+1)%100 {
+			return 0, fmt.Errorf("invalid academic year %q, the years must be consecutive", s)
+		}
+	}
+	return start, nil
+}
+
+// ParseSemester parses a semester such as "1", "2C" or "S2". An empty semester returns 0.
+func ParseSemester(s string) (int, error) {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "":
+		return 0, nil
+	case "1", "1C", "S1", "C1":
+		return 1, nil
+	case "2", "2C", "S2", "C2":
+		return 2, nil
+	}
+	return 0, fmt.Errorf("invalid semester %q, expected 1 or 2", s)
+}
+
+// Term selects the courses of an academic year and semester, 0 selects any
+type Term struct {
+	Year     int
+	Semester int
+}
+
+// Filter keeps the courses of the term. Courses without a start date are removed if a term is set.
+func (t Term) Filter(courses types.Courses) types.Courses {
+	if t.Year == 0 && t.Semester == 0 {
+		return courses
+	}
+	filtered := make(types.Courses, 0, len(courses))
+	for _, course := range courses {
+		year, semester := course.AcademicYear()
+		if (t.Year != 0 && year != t.Year) || (t.Semester != 0 && semester != t.Semester) {
+			slog.Debug("Skipping course of another term", logging.KeyCourseID, course.ID, logging.KeyCourseName, course.Name, "year", year, "semester", semester)
+			continue
+		}
+		filtered = append(filtered, course)
+	}
+	slog.Info("Courses of the selected term", "count", len(filtered), "year", t.Year, "semester", t.Semester)
+	return filtered
+}
+
+// sortByYear sorts the courses from the newest academic year to the oldest, leaving the ones
+// without a start date at the end, and keeps the order of the courses of the same year
+func sortByYear(courses types.Courses) types.Courses {
+	sorted := append(types.Courses(nil), courses...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		yearI, _ := sorted[i].AcademicYear()
+		yearJ, _ := sorted[j].AcademicYear()
+		return yearI > yearJ
+	})
+	return sorted
+}
+
+// yearHeader is the title of the group of courses of an academic year in the selector
+func yearHeader(course types.Course) string {
+	year, _ := course.AcademicYear()
+	if year == 0 {
+		return "── Unknown year ──"
+	}
+	return fmt.Sprintf("── %s ──", types.FormatAcademicYear(year, "/"))
+}
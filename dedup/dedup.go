@@ -0,0 +1,271 @@
+package dedup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	logging "github.com/Astrak00/AGDownloader/logging"
+	state "github.com/Astrak00/AGDownloader/state"
+)
+
+// indexFile is kept with the other files of the download directory that are kept between runs
+const indexFile = "dedup-index.json"
+
+// Method selects how a duplicate is replaced
+type Method string
+
+const (
+	MethodAuto     Method = "auto"     // Reflink if the file system supports it, otherwise hardlink
+	MethodReflink  Method = "reflink"  // Copy-on-write clone, each file can still be modified independently
+	MethodHardlink Method = "hardlink" // Both paths point to the same file
+)
+
+// ParseMethod validates the name of a deduplication method
+func ParseMethod(method string) (Method, error) {
+	switch Method(method) {
+	case MethodAuto, MethodReflink, MethodHardlink:
+		return Method(method), nil
+	}
+	return "", fmt.Errorf("unknown dedup method %q (auto, reflink, hardlink)", method)
+}
+
+// Stats reports the result of the deduplication
+type Stats struct {
+	Files      int   // Files hashed
+	Duplicates int   // Duplicates replaced by a link
+	Copies     int   // Duplicates that had to be kept as copies
+	SpaceSaved int64 // Bytes no longer stored twice
+}
+
+// Index is a content-addressed index of the files in the download directory.
+// It maps the SHA-256 of every file to the first path where it was found.
+type Index struct {
+	mu     sync.Mutex
+	root   string
+	method Method
+	files  map[string]string // SHA-256 -> path relative to root
+	stats  Stats
+}
+
+type indexData struct {
+	Version int               `json:"version"`
+	Files   map[string]string `json:"files"`
+}
+
+// Open loads the index of the download directory, or creates an empty one
+func Open(root string, method Method) (*Index, error) {
+	idx := &Index{root: root, method: method, files: make(map[string]string)}
+
+	data, err := os.ReadFile(idx.path())
+	if errors.Is(err, fs.ErrNotExist) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the dedup index: %v", err)
+	}
+
+	var stored indexData
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("failed to parse the dedup index: %v", err)
+	}
+	if stored.Files != nil {
+		idx.files = stored.Files
+	}
+	return idx, nil
+}
+
+func (idx *Index) path() string {
+	return state.Path(idx.root, indexFile)
+}
+
+// Save writes the index to the download directory
+func (idx *Index) Save() error {
+	if idx == nil {
+		return nil
+	}
+
+	idx.mu.Lock()
+	data, err := json.MarshalIndent(indexData{Version: 1, Files: idx.files}, "", "  ")
+	idx.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(idx.path()), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create the dedup index directory: %v", err)
+	}
+	// Write to a temporary file first, so an interrupted run never leaves a truncated index
+	tmp := idx.path() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write the dedup index: %v", err)
+	}
+	return os.Rename(tmp, idx.path())
+}
+
+// Stats returns the result of the deduplication so far
+func (idx *Index) Stats() Stats {
+	if idx == nil {
+		return Stats{}
+	}
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	return idx.stats
+}
+
+// Add hashes the file and, if the same content is already in the index, replaces the file with a link to it
+func (idx *Index) Add(path string) error {
+	if idx == nil {
+		return nil
+	}
+
+	hash, size, err := hashFile(path)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(idx.root, path)
+	if err != nil {
+		return err
+	}
+
+	rel = filepath.ToSlash(rel)
+
+	idx.mu.Lock()
+	idx.stats.Files++
+	canonicalRel, ok := idx.files[hash]
+	if !ok || canonicalRel == rel {
+		idx.files[hash] = rel
+		idx.mu.Unlock()
+		return nil
+	}
+	idx.mu.Unlock()
+
+	// The first copy may have been deleted or modified since it was indexed, so it is checked
+	// (without holding the lock, hashing may take a while) before linking to it
+	canonical := filepath.Join(idx.root, filepath.FromSlash(canonicalRel))
+	canonicalInfo, err := os.Stat(canonical)
+	if err == nil {
+		if info, statErr := os.Stat(path); statErr == nil && os.SameFile(info, canonicalInfo) {
+			// Already linked
+			return nil
+		}
+	}
+	if err != nil || canonicalInfo.Size() != size {
+		idx.replace(hash, rel)
+		return nil
+	}
+	if canonicalHash, _, err := hashFile(canonical); err != nil || canonicalHash != hash {
+		idx.replace(hash, rel)
+		return nil
+	}
+
+	linkErr := idx.link(canonical, path)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if linkErr != nil {
+		// Keep the copy, the content is still correct
+		idx.stats.Copies++
+		slog.Debug("Duplicate kept as a copy", logging.KeyPath, path, "original", canonical, logging.KeyError, linkErr)
+		return nil
+	}
+	idx.stats.Duplicates++
+	idx.stats.SpaceSaved += size
+	slog.Debug("Duplicate replaced with a link", logging.KeyPath, path, "original", canonical, "method", idx.method)
+	return nil
+}
+
+// replace makes path the new first copy of the content
+func (idx *Index) replace(hash string, rel string) {
+	idx.mu.Lock()
+	idx.files[hash] = rel
+	idx.mu.Unlock()
+}
+
+// errDifferentTimes keeps a duplicate as a copy when a hardlink would change its modification time
+var errDifferentTimes = errors.New("the files have different modification times")
+
+// link replaces path with a link to canonical, using the configured method
+func (idx *Index) link(canonical string, path string) error {
+	// A hardlink shares the modification time of the first copy, and setting the time of one of them
+	// changes both, so it is only made when they already have the same time
+	hardlink := func(tmp string) error {
+		canonicalInfo, err := os.Stat(canonical)
+		if err != nil {
+			return err
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if !canonicalInfo.ModTime().Equal(info.ModTime()) {
+			return errDifferentTimes
+		}
+		return os.Link(canonical, tmp)
+	}
+
+	tmp := path + ".dedup"
+	var err error
+	switch idx.method {
+	case MethodReflink:
+		err = reflink(canonical, tmp)
+	case MethodHardlink:
+		err = hardlink(tmp)
+	default:
+		if err = reflink(canonical, tmp); err != nil {
+			os.Remove(tmp)
+			err = hardlink(tmp)
+		}
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Scan adds every file already in the download directory to the index, linking the duplicates
+func (idx *Index) Scan() error {
+	return filepath.WalkDir(idx.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == state.Dir || d.Name() == "error_logs" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || strings.HasSuffix(path, ".part") {
+			return nil
+		}
+		if err := idx.Add(path); err != nil {
+			slog.Warn("Error deduplicating file", logging.KeyPath, path, logging.KeyError, err)
+		}
+		return nil
+	})
+}
+
+func hashFile(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), size, nil
+}
@@ -0,0 +1,10 @@
+//go:build darwin
+
+package dedup
+
+import "golang.org/x/sys/unix"
+
+// reflink creates dst as a copy-on-write clone of src (APFS)
+func reflink(src string, dst string) error {
+	return unix.Clonefile(src, dst, 0)
+}
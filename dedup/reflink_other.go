@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package dedup
+
+import "errors"
+
+// reflink is not supported on this platform
+func reflink(src string, dst string) error {
+	return errors.ErrUnsupported
+}
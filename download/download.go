@@ -1,52 +1,104 @@
 package download
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	dedup "github.com/Astrak00/AGDownloader/dedup"
 	errorlog "github.com/Astrak00/AGDownloader/errorlog"
+	logging "github.com/Astrak00/AGDownloader/logging"
+	ratelimit "github.com/Astrak00/AGDownloader/ratelimit"
+	redact "github.com/Astrak00/AGDownloader/redact"
 	types "github.com/Astrak00/AGDownloader/types"
-	"github.com/fatih/color"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-isatty"
 )
 
 const (
 	maxRetries     = 3
 	initialBackoff = 1 * time.Second
+	// partSuffix is added to the files while they are being downloaded
+	partSuffix = ".part"
 )
 
+// refreshInterval is how often the speed, ETA and active transfers are updated
+const refreshInterval = 250 * time.Millisecond
+
+// maxShownTransfers limits the number of active transfers listed in the view
+const maxShownTransfers = 8
+
 type model struct {
+	listing        bool // The courses are still being listed, so totalFiles may grow
 	totalFiles     int32
 	completedFiles int32
-	currentFile    string
+	skippedFiles   int
 	errs           []string
-	cancelled      bool
+	stopping       bool               // No new downloads are started, the ones in progress are finishing
+	stop           context.CancelFunc // Stops starting new downloads
+	cancelled      bool               // Exit without waiting for the downloads in progress
 	errorLogger    *errorlog.ErrorLogger
+	tracker        *tracker
+	lastBytes      int64
+	lastTick       time.Time
+	speed          float64 // Smoothed throughput in bytes per second
+}
+
+type tickMsg time.Time
+
+func tick() tea.Cmd {
+	return tea.Tick(refreshInterval, func(t time.Time) tea.Msg { return tickMsg(t) })
 }
 
 func (m model) Init() tea.Cmd {
-	// No initialization
-	return nil
+	return tick()
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
+	case tickMsg:
+		// Exponential moving average of the throughput, so the ETA doesn't jump around
+		now := time.Time(msg)
+		doneBytes := m.tracker.doneBytes.Load()
+		if !m.lastTick.IsZero() {
+			if elapsed := now.Sub(m.lastTick).Seconds(); elapsed > 0 {
+				current := float64(doneBytes-m.lastBytes) / elapsed
+				if m.speed == 0 {
+					m.speed = current
+				} else {
+					m.speed = 0.8*m.speed + 0.2*current
+				}
+			}
+		}
+		m.lastBytes = doneBytes
+		m.lastTick = now
+		return m, tick()
+
+	case queuedMsg:
+		m.totalFiles++
+		return m, nil
+
+	case listingDoneMsg:
+		m.listing = false
+		return m, nil
+
 	case progressMsg:
 		atomic.AddInt32(&m.completedFiles, 1)
-		m.currentFile = msg.fileName
 		return m, nil
 
 	case errorMsg:
-		errStr := fmt.Sprintf("Error downloading %s: %v", msg.fileName, msg.err)
+		errStr := redact.String(fmt.Sprintf("Error downloading %s: %v", msg.fileName, msg.err))
 		m.errs = append(m.errs, errStr)
 
 		// Log error to file
@@ -56,30 +108,44 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				fmt.Sprintf("Failed to download file: %s", msg.fileName),
 				msg.err,
 				map[string]string{
-					"file":      msg.fileName,
-					"file_url":  msg.fileURL,
-					"file_path": msg.filePath,
+					errorlog.DetailFile:         msg.fileName,
+					errorlog.DetailFileURL:      msg.fileURL,
+					errorlog.DetailFilePath:     msg.filePath,
+					errorlog.DetailCourseID:     msg.courseID,
+					errorlog.DetailTimeModified: strconv.FormatInt(msg.timeModified, 10),
 				},
 			)
 		}
 		return m, nil
 
+	case stoppingMsg:
+		m.stopping = true
+		return m, nil
+
+	case skippedMsg:
+		// Stopping the run is not an error, the file is downloaded by the next run
+		m.skippedFiles++
+		return m, nil
+
 	case tea.KeyMsg:
 		if msg.String() == "q" || msg.String() == "esc" || msg.String() == "ctrl+c" {
-			m.cancelled = true
-			return m, tea.Quit
+			// The first time, stop starting new downloads. The second time, exit right away
+			if m.stopping {
+				m.cancelled = true
+				return m, tea.Quit
+			}
+			m.stopping = true
+			m.stop()
+			return m, nil
 		}
 	}
 
 	return m, nil
 }
 
-func (m model) View() string {
-	// Gradient styling
-
-	progress := float64(m.completedFiles) / float64(m.totalFiles) * 100
-	barWidth := 30
-	filled := int(progress / 100 * float64(barWidth))
+// progressBar renders a bar of the given width filled up to progress (0 to 100)
+func progressBar(progress float64, barWidth int) string {
+	filled := min(max(int(progress/100*float64(barWidth)), 0), barWidth)
 	empty := barWidth - filled
 
 	filledBar := lipgloss.NewStyle().
@@ -90,38 +156,107 @@ func (m model) View() string {
 		Foreground(lipgloss.Color("#353C49")).
 		Render(string(repeat(' ', empty)))
 
-	bar := fmt.Sprintf("%s%s %.1f%%", filledBar, emptyBar, progress)
+	return filledBar + emptyBar
+}
+
+func (m model) View() string {
+	totalBytes := m.tracker.totalBytes.Load()
+	doneBytes := m.tracker.doneBytes.Load()
+
+	// Use the bytes when the sizes are known, otherwise fall back to the number of files
+	var progress float64
+	if totalBytes > 0 {
+		progress = float64(doneBytes) / float64(totalBytes) * 100
+	} else if m.totalFiles > 0 {
+		progress = float64(m.completedFiles) / float64(m.totalFiles) * 100
+	}
+	progress = min(progress, 100)
+
+	bar := fmt.Sprintf("%s %.1f%%", progressBar(progress, 30), progress)
+
+	eta := "--"
+	if m.speed > 0 && totalBytes > doneBytes {
+		eta = formatDuration(time.Duration(float64(totalBytes-doneBytes) / m.speed * float64(time.Second)))
+	}
+	average := float64(doneBytes) / max(time.Since(m.tracker.startTime).Seconds(), 1)
+
+	title := "Downloading files..."
+	if m.listing {
+		title = "Listing courses and downloading files..."
+	}
 
 	view := lipgloss.NewStyle().
 		Foreground(lipgloss.Color("#FFFFFF")).
-		Render(fmt.Sprintf("Downloading files...\n%s\nCompleted: %d/%d\n", bar, m.completedFiles, m.totalFiles))
+		Render(fmt.Sprintf("%s\n%s\nCompleted: %d/%d files, %s/%s\nSpeed: %s/s (average %s/s)   ETA: %s\n",
+			title, bar, m.completedFiles, m.totalFiles,
+			types.FormatBytes(doneBytes), types.FormatBytes(totalBytes),
+			types.FormatBytes(int64(m.speed)), types.FormatBytes(int64(average)), eta))
 
-	if m.currentFile != "" {
-		view += lipgloss.NewStyle().
+	if transfers := m.tracker.activeTransfers(); len(transfers) > 0 {
+		view += "\n" + lipgloss.NewStyle().
 			Foreground(lipgloss.Color("#FF8C00")).
-			Render(fmt.Sprintf("\nCurrent file: %s\n", m.currentFile))
+			Render(fmt.Sprintf("Active transfers (%d):", len(transfers))) + "\n"
+		for i, tr := range transfers {
+			if i == maxShownTransfers {
+				view += fmt.Sprintf("  ... and %d more\n", len(transfers)-maxShownTransfers)
+				break
+			}
+			done, total := tr.done.Load(), tr.total.Load()
+			if total > 0 {
+				fileProgress := min(float64(done)/float64(total)*100, 100)
+				view += fmt.Sprintf("  %s %3.0f%% %s/%s %s\n", progressBar(fileProgress, 10), fileProgress, types.FormatBytes(done), types.FormatBytes(total), tr.name)
+			} else {
+				view += fmt.Sprintf("  %s %s %s\n", progressBar(0, 10), types.FormatBytes(done), tr.name)
+			}
+		}
 	}
 	if len(m.errs) > 0 {
-		view += lipgloss.NewStyle().
+		view += "\n" + lipgloss.NewStyle().
 			Foreground(lipgloss.Color("#FF3333")).
-			Render("\nErrors:\n")
+			Render("Errors:") + "\n"
 		for _, e := range m.errs {
 			view += fmt.Sprintf("- %s\n", e)
 		}
 	}
-	view += "\nPress 'q' to quit.\n"
+	if m.stopping {
+		view += lipgloss.NewStyle().
+			Foreground(lipgloss.Color("#FF8C00")).
+			Render(fmt.Sprintf("\nStopping: waiting for the downloads in progress to finish (%d files skipped).", m.skippedFiles)) + "\n"
+		view += "Press 'q' again to exit right away.\n"
+	} else {
+		view += "\nPress 'q' to stop.\n"
+	}
 	return view
 }
 
+// queuedMsg is sent when a new file is received to be downloaded
+type queuedMsg struct{}
+
+// listingDoneMsg is sent when no more files will be received
+type listingDoneMsg struct{}
+
+// stoppingMsg is sent when the run is stopped and no new downloads will be started
+type stoppingMsg struct{}
+
+// skippedMsg is sent for every file that won't be downloaded because the run was stopped
+type skippedMsg struct{}
+
 type progressMsg struct {
 	fileName string
 }
 
 type errorMsg struct {
-	fileName string
-	fileURL  string
-	filePath string
-	err      error
+	fileName     string
+	fileURL      string
+	filePath     string
+	courseID     string
+	timeModified int64
+	err          error
+}
+
+// isTerminal reports whether the file is an interactive terminal
+func isTerminal(f *os.File) bool {
+	return isatty.IsTerminal(f.Fd()) || isatty.IsCygwinTerminal(f.Fd())
 }
 
 func repeat(char rune, count int) []rune {
@@ -132,83 +267,264 @@ func repeat(char rune, count int) []rune {
 	return out
 }
 
-// DownloadFiles orchestrates the file downloads and displays progress using Bubble Tea.
-func DownloadFiles(filesStoreChan <-chan types.FileStore, maxGoroutines int, courses []types.Course, errLogger *errorlog.ErrorLogger) {
-	totalFiles := len(filesStoreChan)
-	if maxGoroutines == -1 {
-		maxGoroutines = totalFiles
+// Options configures how the files are downloaded
+type Options struct {
+	MaxGoroutines  int          // Number of workers, -1 starts one worker per file
+	Schedule       Schedule     // Policy used to pick the next file
+	PerCourseLimit int          // Maximum simultaneous downloads of the same course, 0 means unlimited
+	Dedup          *dedup.Index // Replaces the downloaded duplicates with links, nil disables it
+	Root           string       // Download directory, the directories inside it get the time of their newest file if DirTimes is set
+	DirTimes       bool
+	Events         func(Event) // Called for every file queued, downloaded, failed or skipped, nil disables it
+	Quiet          bool        // Hide the progress view, for runs that are followed through Events
+	Stop           func()      // Called when the user stops the run, to stop the listing as well, nil does nothing
+}
+
+// Event types
+const (
+	EventQueued     = "queued"
+	EventDownloaded = "downloaded"
+	EventFailed     = "failed"
+	EventSkipped    = "skipped"
+)
+
+// Event reports the progress of a file to the observers other than the progress view, such as the dashboard
+type Event struct {
+	Type     string `json:"type"`
+	File     string `json:"file"`
+	CourseID string `json:"course_id"`
+	Size     int64  `json:"size"`
+	Error    string `json:"error,omitempty"`
+}
+
+// emit reports the event of a file, if there is an observer
+func (o Options) emit(eventType string, fileStore types.FileStore, err error) {
+	if o.Events == nil {
+		return
+	}
+	event := Event{Type: eventType, File: fileStore.FileName, CourseID: fileStore.CourseID, Size: fileStore.FileSize}
+	if err != nil {
+		event.Error = redact.Error(err).Error()
 	}
+	o.Events(event)
+}
+
+// Summary is the result of a call to DownloadFiles
+type Summary struct {
+	Completed int  // Files downloaded
+	Failed    int  // Files that could not be downloaded
+	Skipped   int  // Files not downloaded because the run was stopped
+	Stopped   bool // The run was stopped before every file was downloaded
+}
 
+// DownloadFiles orchestrates the file downloads and displays progress using Bubble Tea.
+// The downloads start as soon as the files are received, so the channel can be filled while
+// the courses are still being listed. The progress view grows until the channel is closed.
+// The files are handed to a bounded pool of workers following the schedule of the options.
+//
+// When the context is cancelled, or the user presses 'q', no new downloads are started and the
+// ones in progress are allowed to finish, unless they are waiting for the bandwidth limit.
+// Pressing 'q' again exits immediately.
+// The files that were not downloaded are counted as skipped, they are not errors.
+func DownloadFiles(ctx context.Context, filesStoreChan <-chan types.FileStore, opts Options, courses []types.Course, errLogger *errorlog.ErrorLogger) Summary {
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	progressTracker := newTracker()
 	m := model{
-		totalFiles:  int32(totalFiles),
+		listing:     true,
 		errorLogger: errLogger,
+		tracker:     progressTracker,
+		stop: func() {
+			stop()
+			if opts.Stop != nil {
+				opts.Stop()
+			}
+		},
 	}
 
-	if m.totalFiles == 0 {
-		color.Red("No files to download\n")
-		return
+	// Create the Bubble Tea program. The signals are handled by the caller through the context,
+	// so an interrupt stops the downloads gracefully instead of killing the view
+	programOpts := []tea.ProgramOption{tea.WithoutSignalHandler()}
+	if !isTerminal(os.Stdin) || opts.Quiet {
+		// Unattended runs (cron, services...) have no keyboard, they are stopped with signals
+		programOpts = append(programOpts, tea.WithInput(nil))
 	}
+	if opts.Quiet {
+		programOpts = append(programOpts, tea.WithOutput(io.Discard))
+	}
+	p := tea.NewProgram(m, programOpts...)
 
-	// Create the Bubble Tea program
-	p := tea.NewProgram(m)
+	// The logs written to the terminal while the progress view is shown are printed once it is closed
+	releaseLogs := func() {}
+	if !opts.Quiet {
+		releaseLogs = logging.HoldConsole()
+	}
 
 	// Start the program in a goroutine
 	go func() {
+		defer redact.Recover()
 		var wg sync.WaitGroup
-		semaphore := make(chan struct{}, maxGoroutines)
-
-		for fileStore := range filesStoreChan {
-			wg.Add(1)
-			go func(fileStore types.FileStore) {
-				defer wg.Done()
-				semaphore <- struct{}{}
-				defer func() { <-semaphore }()
-				if err := downloadFileWithRetry(fileStore, 0); err != nil {
+		queue := newScheduler(opts.Schedule, opts.PerCourseLimit)
+		directories := newDirTimes(opts.Root, opts.DirTimes)
+
+		// Stop handing out files as soon as the context is cancelled, until every download has finished
+		finished := make(chan struct{})
+		go func() {
+			select {
+			case <-ctx.Done():
+			case <-finished:
+				return
+			}
+			p.Send(stoppingMsg{})
+			for _, fileStore := range queue.cancel() {
+				opts.emit(EventSkipped, fileStore, nil)
+				p.Send(skippedMsg{})
+			}
+		}()
+
+		worker := func() {
+			defer redact.Recover()
+			defer wg.Done()
+			for {
+				fileStore, ok := queue.pop()
+				if !ok {
+					return
+				}
+				err := downloadFileWithRetry(ctx, fileStore, progressTracker, 0)
+				if err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+					// Stopped while waiting for the limits, the file is skipped like the ones that were not started
+					opts.emit(EventSkipped, fileStore, nil)
+					p.Send(skippedMsg{})
+				} else if err != nil {
+					opts.emit(EventFailed, fileStore, err)
 					p.Send(errorMsg{
-						fileName: fileStore.FileName,
-						fileURL:  fileStore.FileURL,
-						filePath: fileStore.Dir,
-						err:      err,
+						fileName:     fileStore.FileName,
+						fileURL:      fileStore.FileURL,
+						filePath:     fileStore.Dir,
+						courseID:     fileStore.CourseID,
+						timeModified: fileStore.TimeModified,
+						err:          err,
 					})
 				} else {
+					if err := opts.Dedup.Add(fileStore.Dir); err != nil {
+						slog.Warn("Error deduplicating file", logging.KeyPath, fileStore.Dir, logging.KeyError, err)
+					}
+					// A reflink made by the deduplication gets the current time
+					setModTime(fileStore.Dir, fileStore.TimeModified)
+					directories.record(fileStore.Dir, fileStore.TimeModified)
+					opts.emit(EventDownloaded, fileStore, nil)
 					p.Send(progressMsg{fileName: fileStore.FileName})
 				}
-			}(fileStore)
+				queue.done(fileStore)
+			}
 		}
+
+		// The workers are started as the files arrive, up to the limit
+		workers := 0
+		for fileStore := range filesStoreChan {
+			progressTracker.queue(fileStore.FileSize)
+			opts.emit(EventQueued, fileStore, nil)
+			p.Send(queuedMsg{})
+			if ctx.Err() != nil {
+				// Keep receiving so the listing is never blocked, but don't download anything else
+				opts.emit(EventSkipped, fileStore, nil)
+				p.Send(skippedMsg{})
+				continue
+			}
+			queue.push(fileStore)
+			if opts.MaxGoroutines <= 0 || workers < opts.MaxGoroutines {
+				workers++
+				wg.Add(1)
+				go worker()
+			}
+		}
+		// The channel is closed once every course has been listed
+		queue.close()
+		p.Send(listingDoneMsg{})
 		wg.Wait()
+		close(finished)
+
+		// Nothing else is written to the directories once every worker has finished
+		directories.apply()
 
 		// Quit the program after all downloads are complete
 		p.Send(tea.Quit())
 	}()
 
 	finalModel, err := p.Run()
+	releaseLogs()
 	if err != nil {
-		log.Fatalf("Error: %v\n", err)
+		logging.Fatal("Error running the download progress view", logging.KeyError, err)
 	}
 
-	if finalModel.(model).cancelled {
-		os.Exit(0)
+	final := finalModel.(model)
+	if final.cancelled {
+		// Second request to stop, exit without waiting for the downloads in progress
+		slog.Warn("Download interrupted, the files being downloaded were left as .part files")
+		os.Exit(130)
 	}
 
-	color.Green("Download completed successfully \n")
+	summary := Summary{
+		Completed: int(final.completedFiles),
+		Failed:    len(final.errs),
+		Skipped:   final.skippedFiles,
+		Stopped:   final.stopping,
+	}
+	if final.totalFiles == 0 && !final.stopping {
+		slog.Warn("No files to download")
+		return summary
+	}
+	if summary.Stopped {
+		slog.Warn("Download stopped", "files", summary.Completed, "errors", summary.Failed, "skipped", summary.Skipped)
+	} else {
+		slog.Info("Download completed", "files", summary.Completed, "errors", summary.Failed)
+	}
+	return summary
 }
 
-// downloadFileWithRetry attempts to download a file with exponential backoff retry logic
-func downloadFileWithRetry(fileStore types.FileStore, attemptNum int) error {
-	err := downloadFile(fileStore)
+// downloadFileWithRetry attempts to download a file with exponential backoff retry logic.
+// No new attempt is made once the context is cancelled.
+func downloadFileWithRetry(ctx context.Context, fileStore types.FileStore, progressTracker *tracker, attemptNum int) error {
+	tr := progressTracker.start(fileStore.FileName, fileStore.FileSize)
+	err := downloadFile(ctx, fileStore, progressTracker, tr)
+	progressTracker.finish(tr)
+	if err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		// Stopped while waiting for the limits, there is nothing to retry
+		return err
+	}
 	if err != nil && attemptNum < maxRetries {
+		progressTracker.reset(tr)
+
 		// Calculate backoff duration (exponential backoff)
 		backoffDuration := initialBackoff * time.Duration(1<<uint(attemptNum))
-		log.Printf("Download failed for %s (retry %d of %d), retrying in %v: %v\n",
-			fileStore.FileName, attemptNum+1, maxRetries, backoffDuration, err)
-
-		time.Sleep(backoffDuration)
-		return downloadFileWithRetry(fileStore, attemptNum+1)
+		slog.Warn("Download failed, retrying",
+			logging.KeyFile, fileStore.FileName,
+			logging.KeyAttempt, attemptNum+1,
+			"max_retries", maxRetries,
+			"backoff", backoffDuration,
+			logging.KeyError, err)
+
+		select {
+		case <-time.After(backoffDuration):
+		case <-ctx.Done():
+			return fmt.Errorf("%v (not retried, the download was stopped)", err)
+		}
+		return downloadFileWithRetry(ctx, fileStore, progressTracker, attemptNum+1)
 	}
 	return err
 }
 
-func downloadFile(fileStore types.FileStore) error {
+// downloadFile downloads the file to a temporary .part file, that is renamed once the download
+// is complete. A file that is only partially downloaded is removed, so it is never mistaken for a complete one.
+// The cancellation of the run only stops the waits for the request rate and the bandwidth limits, so a download
+// that is not limited is always allowed to finish.
+func downloadFile(ctx context.Context, fileStore types.FileStore, progressTracker *tracker, tr *transfer) error {
+	// Every download counts as a request against the shared request rate
+	if err := ratelimit.Requests.Wait(ctx); err != nil {
+		return err
+	}
+
 	resp, err := http.Get(fileStore.FileURL)
 	if err != nil {
 		return fmt.Errorf("error downloading the file: %v", err)
@@ -216,30 +532,40 @@ func downloadFile(fileStore types.FileStore) error {
 	defer func(Body io.ReadCloser) {
 		err := Body.Close()
 		if err != nil {
-			fmt.Println("Error closing body")
+			slog.Warn("Error closing response body", logging.KeyFile, fileStore.FileName, logging.KeyError, err)
 		}
 	}(resp.Body)
 
+	progressTracker.setSize(tr, resp.ContentLength)
+
 	dir := filepath.Dir(fileStore.Dir)
 	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
 		return fmt.Errorf("error creating the directory: %v", err)
 	}
 
-	out, err := os.Create(fileStore.Dir)
+	partPath := fileStore.Dir + partSuffix
+	out, err := os.Create(partPath)
 	if err != nil {
 		return fmt.Errorf("error creating the file: %v", err)
 	}
-	defer func(out *os.File) {
-		err := out.Close()
-		if err != nil {
-			fmt.Println("Error closing file")
-		}
-	}(out)
 
-	_, err = io.Copy(out, resp.Body)
+	// The shared bandwidth limit is applied to the body of every download
+	_, err = io.Copy(out, progressTracker.reader(tr, ratelimit.Bandwidth.Reader(ctx, resp.Body)))
+	if closeErr := out.Close(); err == nil && closeErr != nil {
+		err = closeErr
+	}
 	if err != nil {
-		return fmt.Errorf("error copying the file: %v", err)
+		if removeErr := os.Remove(partPath); removeErr != nil {
+			slog.Warn("Error removing partial file", logging.KeyPath, partPath, logging.KeyError, removeErr)
+		}
+		return fmt.Errorf("error copying the file: %w", err)
 	}
 
+	// The time is set before renaming, so a complete file always has the time it has in AulaGlobal
+	setModTime(partPath, fileStore.TimeModified)
+
+	if err := os.Rename(partPath, fileStore.Dir); err != nil {
+		return fmt.Errorf("error renaming the downloaded file: %v", err)
+	}
 	return nil
 }
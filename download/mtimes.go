@@ -0,0 +1,82 @@
+package download
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	logging "github.com/Astrak00/AGDownloader/logging"
+)
+
+// setModTime sets the modification time of a file to the one it has in AulaGlobal.
+// Files without a known modification time keep the current one.
+func setModTime(path string, timeModified int64) {
+	if timeModified <= 0 {
+		return
+	}
+	mtime := time.Unix(timeModified, 0)
+	if err := os.Chtimes(path, time.Now(), mtime); err != nil {
+		slog.Warn("Error setting the modification time", logging.KeyPath, path, logging.KeyError, err)
+	}
+}
+
+// dirTimes records the newest modification time of the files downloaded to every directory,
+// so the directories can be given that time once nothing else is written to them
+type dirTimes struct {
+	root string
+
+	mu    sync.Mutex
+	times map[string]int64
+}
+
+// newDirTimes returns nil if the times of the directories must not be changed
+func newDirTimes(root string, enabled bool) *dirTimes {
+	if !enabled || root == "" {
+		return nil
+	}
+	return &dirTimes{root: filepath.Clean(root), times: make(map[string]int64)}
+}
+
+// record updates the directories between the root and the file, the root itself is left unchanged
+func (d *dirTimes) record(path string, timeModified int64) {
+	if d == nil || timeModified <= 0 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		// The root may be ".", so the paths are compared once they are relative to it
+		rel, err := filepath.Rel(d.root, dir)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			break
+		}
+		if timeModified > d.times[dir] {
+			d.times[dir] = timeModified
+		}
+	}
+}
+
+// apply sets the recorded times, starting with the deepest directories, as changing a directory doesn't change its parent
+func (d *dirTimes) apply() {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	dirs := make([]string, 0, len(d.times))
+	for dir := range d.times {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		return strings.Count(dirs[i], string(filepath.Separator)) > strings.Count(dirs[j], string(filepath.Separator))
+	})
+	for _, dir := range dirs {
+		setModTime(dir, d.times[dir])
+	}
+}
@@ -0,0 +1,114 @@
+package download
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// transfer is a file being downloaded
+type transfer struct {
+	name     string
+	expected int64        // Size reported by AulaGlobal
+	total    atomic.Int64 // 0 if the size is unknown
+	done     atomic.Int64
+	started  time.Time
+}
+
+// tracker keeps the byte counters shared by the download goroutines and the progress view
+type tracker struct {
+	totalBytes atomic.Int64
+	doneBytes  atomic.Int64
+	startTime  time.Time
+
+	mu     sync.Mutex
+	active map[*transfer]struct{}
+}
+
+func newTracker() *tracker {
+	return &tracker{
+		startTime: time.Now(),
+		active:    make(map[*transfer]struct{}),
+	}
+}
+
+// queue adds the expected size of a file to the total
+func (t *tracker) queue(size int64) {
+	t.totalBytes.Add(size)
+}
+
+// start registers a new active transfer of a file with the expected size
+func (t *tracker) start(name string, size int64) *transfer {
+	tr := &transfer{name: name, expected: size, started: time.Now()}
+	tr.total.Store(size)
+
+	t.mu.Lock()
+	t.active[tr] = struct{}{}
+	t.mu.Unlock()
+	return tr
+}
+
+// setSize corrects the expected size of a transfer with the Content-Length sent by the server
+func (t *tracker) setSize(tr *transfer, size int64) {
+	if size <= 0 {
+		return
+	}
+	previous := tr.total.Swap(size)
+	t.totalBytes.Add(size - previous)
+}
+
+// reset discards the bytes and the corrected size of a failed attempt before retrying
+func (t *tracker) reset(tr *transfer) {
+	t.doneBytes.Add(-tr.done.Swap(0))
+	t.totalBytes.Add(tr.expected - tr.total.Swap(tr.expected))
+}
+
+// finish removes the transfer from the active list
+func (t *tracker) finish(tr *transfer) {
+	t.mu.Lock()
+	delete(t.active, tr)
+	t.mu.Unlock()
+}
+
+// activeTransfers returns a copy of the active transfers, the oldest first
+func (t *tracker) activeTransfers() []*transfer {
+	t.mu.Lock()
+	transfers := make([]*transfer, 0, len(t.active))
+	for tr := range t.active {
+		transfers = append(transfers, tr)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(transfers, func(i, j int) bool { return transfers[i].started.Before(transfers[j].started) })
+	return transfers
+}
+
+// reader counts the bytes read from r as progress of the transfer
+func (t *tracker) reader(tr *transfer, r io.Reader) io.Reader {
+	return &countingReader{reader: r, tracker: t, transfer: tr}
+}
+
+type countingReader struct {
+	reader   io.Reader
+	tracker  *tracker
+	transfer *transfer
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.transfer.done.Add(int64(n))
+		r.tracker.doneBytes.Add(int64(n))
+	}
+	return n, err
+}
+
+// formatDuration formats the remaining time, rounded to the second
+func formatDuration(d time.Duration) string {
+	if d <= 0 {
+		return "--"
+	}
+	return d.Round(time.Second).String()
+}
@@ -0,0 +1,218 @@
+package download
+
+import (
+	"container/heap"
+	"fmt"
+	"strings"
+	"sync"
+
+	types "github.com/Astrak00/AGDownloader/types"
+)
+
+// Order decides which file of a course is downloaded first
+type Order string
+
+const (
+	OrderFIFO     Order = "fifo"           // In the order they were listed
+	OrderSmallest Order = "smallest-first" // Smallest files first
+	OrderNewest   Order = "newest-first"   // Most recently modified files first
+)
+
+// Schedule is the policy used by the workers to pick the next file
+type Schedule struct {
+	RoundRobin bool  // Take one file from each course in turn, instead of the best file of any course
+	Order      Order // Order of the files, inside each course when RoundRobin is set
+}
+
+// ParseSchedule parses a policy such as "fifo", "smallest-first", "newest-first", "round-robin"
+// or a combination of round-robin and an order, e.g. "round-robin,newest-first".
+func ParseSchedule(s string) (Schedule, error) {
+	schedule := Schedule{Order: OrderFIFO}
+	if strings.TrimSpace(s) == "" {
+		return schedule, nil
+	}
+
+	orderSet := false
+	for _, part := range strings.Split(s, ",") {
+		switch part := Order(strings.ToLower(strings.TrimSpace(part))); part {
+		case "round-robin":
+			schedule.RoundRobin = true
+		case OrderFIFO, OrderSmallest, OrderNewest:
+			if orderSet {
+				return schedule, fmt.Errorf("only one order can be used in the schedule %q", s)
+			}
+			schedule.Order = part
+			orderSet = true
+		default:
+			return schedule, fmt.Errorf("unknown schedule %q (round-robin, fifo, smallest-first, newest-first)", part)
+		}
+	}
+	return schedule, nil
+}
+
+// queuedFile is a file waiting for a worker
+type queuedFile struct {
+	fileStore types.FileStore
+	seq       int // Arrival order, used to break ties
+}
+
+// fileQueue is a priority queue of the files of a course, sorted by the schedule order
+type fileQueue struct {
+	files []queuedFile
+	order Order
+}
+
+func (q *fileQueue) Len() int           { return len(q.files) }
+func (q *fileQueue) Less(i, j int) bool { return q.order.less(q.files[i], q.files[j]) }
+func (q *fileQueue) Swap(i, j int)      { q.files[i], q.files[j] = q.files[j], q.files[i] }
+func (q *fileQueue) Push(x any)         { q.files = append(q.files, x.(queuedFile)) }
+func (q *fileQueue) Pop() any {
+	last := q.files[len(q.files)-1]
+	q.files = q.files[:len(q.files)-1]
+	return last
+}
+
+func (o Order) less(a, b queuedFile) bool {
+	switch o {
+	case OrderSmallest:
+		if a.fileStore.FileSize != b.fileStore.FileSize {
+			return a.fileStore.FileSize < b.fileStore.FileSize
+		}
+	case OrderNewest:
+		if a.fileStore.TimeModified != b.fileStore.TimeModified {
+			return a.fileStore.TimeModified > b.fileStore.TimeModified
+		}
+	}
+	return a.seq < b.seq
+}
+
+// scheduler holds the files waiting to be downloaded and hands them to the workers
+// following the schedule, without exceeding the per-course limit
+type scheduler struct {
+	mu        sync.Mutex
+	cond      *sync.Cond
+	schedule  Schedule
+	perCourse int // Maximum simultaneous downloads of a course, 0 means unlimited
+	queues    map[string]*fileQueue
+	courses   []string // Course IDs in the order they were first seen, for round-robin
+	next      int      // Position of the next course in round-robin
+	running   map[string]int
+	seq       int
+	closed    bool
+}
+
+func newScheduler(schedule Schedule, perCourse int) *scheduler {
+	s := &scheduler{
+		schedule:  schedule,
+		perCourse: perCourse,
+		queues:    make(map[string]*fileQueue),
+		running:   make(map[string]int),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+// push adds a file to the queue of its course
+func (s *scheduler) push(fileStore types.FileStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	queue, ok := s.queues[fileStore.CourseID]
+	if !ok {
+		queue = &fileQueue{order: s.schedule.Order}
+		s.queues[fileStore.CourseID] = queue
+		s.courses = append(s.courses, fileStore.CourseID)
+	}
+	heap.Push(queue, queuedFile{fileStore: fileStore, seq: s.seq})
+	s.seq++
+	s.cond.Signal()
+}
+
+// close signals that no more files will be pushed
+func (s *scheduler) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+// cancel closes the scheduler and returns the files that were still waiting
+func (s *scheduler) cancel() []types.FileStore {
+	s.mu.Lock()
+	var dropped []types.FileStore
+	for _, courseID := range s.courses {
+		queue := s.queues[courseID]
+		for queue.Len() > 0 {
+			dropped = append(dropped, heap.Pop(queue).(queuedFile).fileStore)
+		}
+	}
+	s.closed = true
+	s.mu.Unlock()
+	s.cond.Broadcast()
+	return dropped
+}
+
+// pop blocks until a file can be downloaded. It returns false once the scheduler
+// is closed and every file has been handed out.
+func (s *scheduler) pop() (types.FileStore, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for {
+		if courseID, ok := s.pick(); ok {
+			file := heap.Pop(s.queues[courseID]).(queuedFile)
+			s.running[courseID]++
+			return file.fileStore, true
+		}
+		if s.closed && s.pending() == 0 {
+			return types.FileStore{}, false
+		}
+		s.cond.Wait()
+	}
+}
+
+// done releases the slot of the course once a download has finished
+func (s *scheduler) done(fileStore types.FileStore) {
+	s.mu.Lock()
+	s.running[fileStore.CourseID]--
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+// pick returns the course whose next file must be downloaded. The lock must be held.
+func (s *scheduler) pick() (string, bool) {
+	eligible := func(courseID string) bool {
+		return s.queues[courseID].Len() > 0 && (s.perCourse <= 0 || s.running[courseID] < s.perCourse)
+	}
+
+	if s.schedule.RoundRobin {
+		for i := range s.courses {
+			position := (s.next + i) % len(s.courses)
+			if eligible(s.courses[position]) {
+				s.next = (position + 1) % len(s.courses)
+				return s.courses[position], true
+			}
+		}
+		return "", false
+	}
+
+	best, found := "", false
+	for _, courseID := range s.courses {
+		if !eligible(courseID) {
+			continue
+		}
+		if !found || s.schedule.Order.less(s.queues[courseID].files[0], s.queues[best].files[0]) {
+			best, found = courseID, true
+		}
+	}
+	return best, found
+}
+
+// pending returns the number of files waiting in the queues. The lock must be held.
+func (s *scheduler) pending() int {
+	total := 0
+	for _, queue := range s.queues {
+		total += queue.Len()
+	}
+	return total
+}
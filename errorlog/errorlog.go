@@ -1,18 +1,27 @@
 package errorlog
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
+
+	logging "github.com/Astrak00/AGDownloader/logging"
+	redact "github.com/Astrak00/AGDownloader/redact"
 )
 
-// ErrorLogger handles logging of all errors during download operations
+// ErrorLogger handles logging of all errors during download operations.
+// Every message, error and detail is written with the secrets masked, so the log can be shared.
 type ErrorLogger struct {
 	file       *os.File
 	logger     *log.Logger
+	jsonFile   *os.File
+	encoder    *json.Encoder
 	mu         sync.Mutex
 	errorCount int
 }
@@ -26,10 +35,31 @@ const (
 	ErrorTypeFileSystem      ErrorType = "FILE_SYSTEM"
 	ErrorTypeNetwork         ErrorType = "NETWORK"
 	ErrorTypeCourseRetrieval ErrorType = "COURSE_RETRIEVAL"
+	ErrorTypeCancelled       ErrorType = "CANCELLED" // File not downloaded because the run was stopped, only in the logs of older versions
+)
+
+// Format selects which files the ErrorLogger writes
+type Format string
+
+const (
+	FormatText  Format = "text"  // Human readable log
+	FormatJSONL Format = "jsonl" // One JSON record per line, that can be read back with ReadRecords
+	FormatBoth  Format = "both"  // Both of the above
 )
 
-// New creates a new ErrorLogger with a timestamped log file
-func New(dirPath string) (*ErrorLogger, error) {
+// ParseFormat validates the name of an error log format
+func ParseFormat(format string) (Format, error) {
+	switch Format(format) {
+	case FormatText, FormatJSONL, FormatBoth:
+		return Format(format), nil
+	case "":
+		return FormatBoth, nil
+	}
+	return "", fmt.Errorf("unknown error log format %q (text, jsonl, both)", format)
+}
+
+// New creates a new ErrorLogger with timestamped log files in the given format
+func New(dirPath string, format Format) (*ErrorLogger, error) {
 	// Create error logs directory if it doesn't exist
 	errorLogDir := filepath.Join(dirPath, "error_logs")
 	if err := os.MkdirAll(errorLogDir, os.ModePerm); err != nil {
@@ -38,48 +68,49 @@ func New(dirPath string) (*ErrorLogger, error) {
 
 	// Create log file with timestamp
 	timestamp := time.Now().Format("2006-01-02_15-04-05")
-	logFileName := fmt.Sprintf("download_errors_%s.log", timestamp)
-	logFilePath := filepath.Join(errorLogDir, logFileName)
+	el := &ErrorLogger{}
 
-	file, err := os.Create(logFilePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create error log file: %v", err)
-	}
+	if format != FormatJSONL {
+		logFilePath := filepath.Join(errorLogDir, fmt.Sprintf("download_errors_%s.log", timestamp))
+		file, err := os.Create(logFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create error log file: %v", err)
+		}
 
-	logger := log.New(file, "", 0)
+		el.file = file
+		el.logger = log.New(file, "", 0)
 
-	// Write header
-	logger.Printf("=======================================================\n")
-	logger.Printf("AGDownloader Error Log\n")
-	logger.Printf("Started: %s\n", time.Now().Format("2006-01-02 15:04:05"))
-	logger.Printf("=======================================================\n\n")
+		// Write header
+		el.logger.Printf("=======================================================\n")
+		el.logger.Printf("AGDownloader Error Log\n")
+		el.logger.Printf("Started: %s\n", time.Now().Format("2006-01-02 15:04:05"))
+		el.logger.Printf("=======================================================\n\n")
+	}
 
-	return &ErrorLogger{
-		file:   file,
-		logger: logger,
-	}, nil
+	if format != FormatText {
+		jsonFilePath := filepath.Join(errorLogDir, fmt.Sprintf("download_errors_%s.jsonl", timestamp))
+		jsonFile, err := os.Create(jsonFilePath)
+		if err != nil {
+			if el.file != nil {
+				el.file.Close()
+			}
+			return nil, fmt.Errorf("failed to create error log file: %v", err)
+		}
+		el.jsonFile = jsonFile
+		el.encoder = json.NewEncoder(jsonFile)
+	}
+
+	return el, nil
 }
 
 // LogError logs an error with context information
 func (el *ErrorLogger) LogError(errorType ErrorType, context string, err error) {
-	if el == nil || el.logger == nil {
-		return
-	}
-
-	el.mu.Lock()
-	defer el.mu.Unlock()
-
-	el.errorCount++
-	timestamp := time.Now().Format("2006-01-02 15:04:05")
-
-	el.logger.Printf("[%s] [%s] %s\n", timestamp, errorType, context)
-	el.logger.Printf("Error: %v\n", err)
-	el.logger.Printf("-------------------------------------------------------\n\n")
+	el.LogErrorWithDetails(errorType, context, err, nil)
 }
 
 // LogErrorWithDetails logs an error with additional details
 func (el *ErrorLogger) LogErrorWithDetails(errorType ErrorType, context string, err error, details map[string]string) {
-	if el == nil || el.logger == nil {
+	if el == nil {
 		return
 	}
 
@@ -87,19 +118,40 @@ func (el *ErrorLogger) LogErrorWithDetails(errorType ErrorType, context string,
 	defer el.mu.Unlock()
 
 	el.errorCount++
-	timestamp := time.Now().Format("2006-01-02 15:04:05")
+	now := time.Now()
+
+	// Sort the keys so the details are always written in the same order
+	keys := make([]string, 0, len(details))
+	for key := range details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
 
-	el.logger.Printf("[%s] [%s] %s\n", timestamp, errorType, context)
-	el.logger.Printf("Error: %v\n", err)
+	attrs := []any{"type", errorType, logging.KeyError, err}
+	for _, key := range keys {
+		attrs = append(attrs, key, details[key])
+	}
+	slog.Error(context, attrs...)
+
+	if el.logger != nil {
+		el.logger.Printf("[%s] [%s] %s\n", now.Format("2006-01-02 15:04:05"), errorType, redact.String(context))
+		el.logger.Printf("Error: %v\n", redact.Error(err))
 
-	if len(details) > 0 {
-		el.logger.Printf("Details:\n")
-		for key, value := range details {
-			el.logger.Printf("  %s: %s\n", key, value)
+		if len(details) > 0 {
+			el.logger.Printf("Details:\n")
+			for _, key := range keys {
+				el.logger.Printf("  %s: %s\n", key, redact.String(details[key]))
+			}
 		}
+
+		el.logger.Printf("-------------------------------------------------------\n\n")
 	}
 
-	el.logger.Printf("-------------------------------------------------------\n\n")
+	if el.encoder != nil {
+		if encErr := el.encoder.Encode(newRecord(errorType, now, context, err, details)); encErr != nil {
+			slog.Warn("Failed to write the JSON error log", logging.KeyError, encErr)
+		}
+	}
 }
 
 // GetErrorCount returns the total number of errors logged
@@ -113,29 +165,49 @@ func (el *ErrorLogger) GetErrorCount() int {
 	return el.errorCount
 }
 
-// Close closes the error log file and writes summary
+// Close closes the error log files and writes summary
 func (el *ErrorLogger) Close() error {
-	if el == nil || el.file == nil {
+	if el == nil {
 		return nil
 	}
 
 	el.mu.Lock()
 	defer el.mu.Unlock()
 
-	// Write summary
-	el.logger.Printf("\n=======================================================\n")
-	el.logger.Printf("Summary\n")
-	el.logger.Printf("Total errors logged: %d\n", el.errorCount)
-	el.logger.Printf("Completed: %s\n", time.Now().Format("2006-01-02 15:04:05"))
-	el.logger.Printf("=======================================================\n")
+	var err error
+	if el.file != nil {
+		// Write summary
+		el.logger.Printf("\n=======================================================\n")
+		el.logger.Printf("Summary\n")
+		el.logger.Printf("Total errors logged: %d\n", el.errorCount)
+		el.logger.Printf("Completed: %s\n", time.Now().Format("2006-01-02 15:04:05"))
+		el.logger.Printf("=======================================================\n")
 
-	return el.file.Close()
+		err = el.file.Close()
+	}
+	if el.jsonFile != nil {
+		if jsonErr := el.jsonFile.Close(); err == nil {
+			err = jsonErr
+		}
+	}
+	return err
 }
 
-// GetLogFilePath returns the path to the log file
+// GetLogFilePath returns the path to the log file, the JSON Lines one if it is the only one written
 func (el *ErrorLogger) GetLogFilePath() string {
-	if el == nil || el.file == nil {
+	if el == nil {
+		return ""
+	}
+	if el.file != nil {
+		return el.file.Name()
+	}
+	return el.GetJSONLogFilePath()
+}
+
+// GetJSONLogFilePath returns the path to the JSON Lines log file, empty if it is not being written
+func (el *ErrorLogger) GetJSONLogFilePath() string {
+	if el == nil || el.jsonFile == nil {
 		return ""
 	}
-	return el.file.Name()
+	return el.jsonFile.Name()
 }
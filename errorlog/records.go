@@ -0,0 +1,120 @@
+package errorlog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	redact "github.com/Astrak00/AGDownloader/redact"
+)
+
+// Keys of the details map that are stored as fields of a Record
+const (
+	DetailCourseID     = "course_id"
+	DetailCourseName   = "course_name"
+	DetailFile         = "file"
+	DetailFileURL      = "file_url"
+	DetailFilePath     = "file_path"
+	DetailTimeModified = "time_modified"
+)
+
+// Record is a line of the JSON Lines error log
+type Record struct {
+	Type         ErrorType         `json:"type"`
+	Timestamp    time.Time         `json:"timestamp"`
+	Message      string            `json:"message"`
+	Error        string            `json:"error,omitempty"`
+	CourseID     string            `json:"course_id,omitempty"`
+	Course       string            `json:"course,omitempty"`
+	File         string            `json:"file,omitempty"`
+	URL          string            `json:"url,omitempty"` // Always redacted, the token must be added again to use it
+	Path         string            `json:"path,omitempty"`
+	TimeModified int64             `json:"time_modified,omitempty"` // Unix time of the last modification in AulaGlobal
+	Details      map[string]string `json:"details,omitempty"`
+}
+
+// newRecord builds a redacted Record, moving the known details to their own fields
+func newRecord(errorType ErrorType, timestamp time.Time, context string, err error, details map[string]string) Record {
+	record := Record{
+		Type:      errorType,
+		Timestamp: timestamp,
+		Message:   redact.String(context),
+	}
+	if err != nil {
+		record.Error = redact.String(err.Error())
+	}
+
+	for key, value := range details {
+		value = redact.String(value)
+		switch key {
+		case DetailCourseID:
+			record.CourseID = value
+		case DetailCourseName:
+			record.Course = value
+		case DetailFile:
+			record.File = value
+		case DetailFileURL:
+			record.URL = value
+		case DetailFilePath:
+			record.Path = value
+		case DetailTimeModified:
+			record.TimeModified, _ = strconv.ParseInt(value, 10, 64)
+		default:
+			if record.Details == nil {
+				record.Details = make(map[string]string)
+			}
+			record.Details[key] = value
+		}
+	}
+	return record
+}
+
+// ReadRecords parses a JSON Lines error log written by a previous run
+func ReadRecords(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open error log: %v", err)
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%s:%d is not a JSON error record: %v", path, lineNumber, err)
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read error log: %v", err)
+	}
+	return records, nil
+}
+
+// FailedDownloads returns the records of the files that could not be downloaded, or were not
+// downloaded because the run was stopped, without duplicates
+func FailedDownloads(records []Record) []Record {
+	seen := make(map[string]struct{})
+	failed := make([]Record, 0, len(records))
+	for _, record := range records {
+		if (record.Type != ErrorTypeDownload && record.Type != ErrorTypeCancelled) || record.URL == "" || record.Path == "" {
+			continue
+		}
+		if _, ok := seen[record.Path]; ok {
+			continue
+		}
+		seen[record.Path] = struct{}{}
+		failed = append(failed, record)
+	}
+	return failed
+}
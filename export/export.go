@@ -0,0 +1,332 @@
+// Package export packages the files of a course in a single .zip or .tar.gz archive, with a manifest
+// and an index page, keeping the sections of the course as directories
+package export
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	files "github.com/Astrak00/AGDownloader/files"
+	logging "github.com/Astrak00/AGDownloader/logging"
+	ratelimit "github.com/Astrak00/AGDownloader/ratelimit"
+	"github.com/Astrak00/AGDownloader/types"
+)
+
+// Format is the type of archive
+type Format int
+
+const (
+	FormatZip Format = iota
+	FormatTarGz
+)
+
+// ParseFormat returns the format of the archive from the extension of its path
+func ParseFormat(archivePath string) (Format, error) {
+	lower := strings.ToLower(archivePath)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return FormatZip, nil
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return FormatTarGz, nil
+	default:
+		return 0, fmt.Errorf("unknown archive format %q, use a .zip, .tar.gz or .tgz file", filepath.Base(archivePath))
+	}
+}
+
+// Options of an export
+type Options struct {
+	Stream bool         // Download the files from AulaGlobal instead of reading the synced ones
+	Target files.Target // File system the names in the archive are made valid for
+}
+
+// Summary of an export
+type Summary struct {
+	Exported int
+	Missing  int // Files that were not synced, only when they are read from disk
+	Failed   int // Files that could not be downloaded or read
+}
+
+// Manifest describes the course and the files of the archive, in manifest.json
+type Manifest struct {
+	CourseID   string         `json:"course_id"`
+	CourseName string         `json:"course_name"`
+	ShortName  string         `json:"short_name"`
+	Year       string         `json:"year,omitempty"`
+	Exported   time.Time      `json:"exported"`
+	Files      []ManifestFile `json:"files"`
+	Missing    []string       `json:"missing,omitempty"` // Files of the course that are not in the archive
+}
+
+// ManifestFile is a file of the archive
+type ManifestFile struct {
+	Path     string `json:"path"` // Relative to the directory of the course
+	Section  string `json:"section"`
+	Module   string `json:"module"`
+	Size     int64  `json:"size"`
+	Modified int64  `json:"modified"` // Unix time of the last modification in AulaGlobal, 0 if unknown
+}
+
+// generalSection names the directory of the files without a section, like the file browser
+const generalSection = "General"
+
+// Course writes the listed files of the course to the archive, with the format of its extension. The archive
+// has a directory named after the course with one directory per section, manifest.json and index.html.
+// The archive is written to a temporary file that is renamed once it is complete.
+func Course(ctx context.Context, archivePath string, course types.Course, listed []types.FileStore, opts Options) (Summary, error) {
+	format, err := ParseFormat(archivePath)
+	if err != nil {
+		return Summary{}, err
+	}
+
+	partPath := archivePath + ".part"
+	out, err := os.Create(partPath)
+	if err != nil {
+		return Summary{}, fmt.Errorf("error creating the archive: %v", err)
+	}
+	summary, err := write(ctx, newArchive(out, format), course, listed, opts)
+	if closeErr := out.Close(); err == nil && closeErr != nil {
+		err = fmt.Errorf("error writing the archive: %v", closeErr)
+	}
+	if err != nil {
+		if removeErr := os.Remove(partPath); removeErr != nil {
+			slog.Warn("Error removing the partial archive", logging.KeyPath, partPath, logging.KeyError, removeErr)
+		}
+		return summary, err
+	}
+	if err := os.Rename(partPath, archivePath); err != nil {
+		return summary, fmt.Errorf("error renaming the archive: %v", err)
+	}
+	return summary, nil
+}
+
+// write adds the files, the manifest and the index to the archive and closes it
+func write(ctx context.Context, a archive, course types.Course, listed []types.FileStore, opts Options) (Summary, error) {
+	var summary Summary
+	root := opts.Target.Component(course.Name)
+	manifest := Manifest{
+		CourseID:   course.ID,
+		CourseName: course.Name,
+		ShortName:  course.ShortName,
+		Exported:   time.Now(),
+		Files:      []ManifestFile{},
+	}
+	if year, _ := course.AcademicYear(); year != 0 {
+		manifest.Year = types.FormatAcademicYear(year, "/")
+	}
+
+	claimed := make(map[string]bool)
+	for _, file := range listed {
+		if err := ctx.Err(); err != nil {
+			a.Close()
+			return summary, err
+		}
+
+		section := file.SectionName
+		if section == "" {
+			section = generalSection
+		}
+		name := entryName(path.Join(opts.Target.Component(section), opts.Target.Component(filepath.Base(file.FileName))), claimed)
+		modified := time.Now()
+		if file.TimeModified > 0 {
+			modified = time.Unix(file.TimeModified, 0)
+		}
+
+		var size int64
+		var err error
+		if opts.Stream {
+			size, err = addDownloaded(ctx, a, path.Join(root, name), modified, file)
+		} else {
+			size, err = addSynced(a, path.Join(root, name), modified, file)
+		}
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			slog.Warn("The file is not synced, it is left out of the archive", logging.KeyFile, file.FileName)
+			summary.Missing++
+			manifest.Missing = append(manifest.Missing, filepath.ToSlash(file.FileName))
+			continue
+		case errors.Is(err, errArchive):
+			a.Close()
+			return summary, err
+		case err != nil:
+			slog.Error("Error exporting the file", logging.KeyFile, file.FileName, logging.KeyError, err)
+			summary.Failed++
+			manifest.Missing = append(manifest.Missing, filepath.ToSlash(file.FileName))
+			continue
+		}
+
+		slog.Debug("Exported file", logging.KeyFile, file.FileName, "entry", name)
+		summary.Exported++
+		manifest.Files = append(manifest.Files, ManifestFile{
+			Path:     name,
+			Section:  section,
+			Module:   file.ModuleName,
+			Size:     size,
+			Modified: file.TimeModified,
+		})
+	}
+
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		a.Close()
+		return summary, fmt.Errorf("error creating the manifest: %v", err)
+	}
+	var index strings.Builder
+	if err := indexTemplate.Execute(&index, indexData(manifest)); err != nil {
+		a.Close()
+		return summary, fmt.Errorf("error creating the index: %v", err)
+	}
+	for _, entry := range []struct {
+		name string
+		data string
+	}{
+		{"manifest.json", string(manifestData) + "\n"},
+		{"index.html", index.String()},
+	} {
+		if err := a.add(path.Join(root, entry.name), int64(len(entry.data)), manifest.Exported, strings.NewReader(entry.data)); err != nil {
+			a.Close()
+			return summary, err
+		}
+	}
+	if err := a.Close(); err != nil {
+		return summary, fmt.Errorf("%w: %v", errArchive, err)
+	}
+	return summary, nil
+}
+
+// entryName returns the name, adding a number before the extension if another file of the archive has it
+func entryName(name string, claimed map[string]bool) string {
+	candidate := name
+	ext := path.Ext(name)
+	for n := 2; claimed[strings.ToLower(candidate)]; n++ {
+		candidate = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), n, ext)
+	}
+	claimed[strings.ToLower(candidate)] = true
+	return candidate
+}
+
+// addSynced adds the downloaded copy of the file. The copy is used even if AulaGlobal has a newer version.
+func addSynced(a archive, name string, modified time.Time, file types.FileStore) (int64, error) {
+	in, err := os.Open(file.Dir)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), a.add(name, info.Size(), modified, in)
+}
+
+// addDownloaded downloads the file to a temporary file, removed once it is added, so a failed download
+// never leaves a truncated entry in the archive
+func addDownloaded(ctx context.Context, a archive, name string, modified time.Time, file types.FileStore) (int64, error) {
+	if err := ratelimit.Requests.Wait(ctx); err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, file.FileURL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error downloading the file: %v", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error downloading the file: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("error downloading the file: %s", resp.Status)
+	}
+
+	tmp, err := os.CreateTemp("", "agdownloader-export-*")
+	if err != nil {
+		return 0, fmt.Errorf("error creating a temporary file: %v", err)
+	}
+	defer func() {
+		tmp.Close()
+		if err := os.Remove(tmp.Name()); err != nil {
+			slog.Warn("Error removing the temporary file", logging.KeyPath, tmp.Name(), logging.KeyError, err)
+		}
+	}()
+	size, err := io.Copy(tmp, ratelimit.Bandwidth.Reader(ctx, resp.Body))
+	if err != nil {
+		return 0, fmt.Errorf("error downloading the file: %v", err)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("error reading the temporary file: %v", err)
+	}
+	return size, a.add(name, size, modified, tmp)
+}
+
+// errArchive marks the errors writing the archive, after which the export can't continue
+var errArchive = errors.New("error writing the archive")
+
+// archive adds the entries to a .zip or .tar.gz file
+type archive interface {
+	add(name string, size int64, modified time.Time, r io.Reader) error
+	Close() error
+}
+
+func newArchive(w io.Writer, format Format) archive {
+	if format == FormatTarGz {
+		gz := gzip.NewWriter(w)
+		return &tarArchive{gz: gz, tw: tar.NewWriter(gz)}
+	}
+	return &zipArchive{zw: zip.NewWriter(w)}
+}
+
+type zipArchive struct {
+	zw *zip.Writer
+}
+
+func (z *zipArchive) add(name string, size int64, modified time.Time, r io.Reader) error {
+	w, err := z.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return fmt.Errorf("%w: %v", errArchive, err)
+	}
+	if _, err := io.Copy(w, r); err != nil {
+		return fmt.Errorf("%w: %v", errArchive, err)
+	}
+	return nil
+}
+
+func (z *zipArchive) Close() error {
+	return z.zw.Close()
+}
+
+type tarArchive struct {
+	gz *gzip.Writer
+	tw *tar.Writer
+}
+
+func (t *tarArchive) add(name string, size int64, modified time.Time, r io.Reader) error {
+	header := &tar.Header{Typeflag: tar.TypeReg, Name: name, Size: size, Mode: 0o644, ModTime: modified, Format: tar.FormatPAX}
+	if err := t.tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("%w: %v", errArchive, err)
+	}
+	// A file that changed size while it was read would corrupt the rest of the archive
+	if _, err := io.CopyN(t.tw, r, size); err != nil {
+		return fmt.Errorf("%w: %v", errArchive, err)
+	}
+	return nil
+}
+
+func (t *tarArchive) Close() error {
+	if err := t.tw.Close(); err != nil {
+		return err
+	}
+	return t.gz.Close()
+}
@@ -0,0 +1,88 @@
+package export
+
+import (
+	"html/template"
+	"path"
+	"time"
+
+	"github.com/Astrak00/AGDownloader/types"
+)
+
+// indexTemplate is the page that links every file of the archive, section by section.
+// The names come from AulaGlobal, so they are escaped by the template.
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html lang="es">
+<head>
+<meta charset="utf-8">
+<title>{{.CourseName}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 60rem; margin: 2rem auto; padding: 0 1rem; color: #222; }
+h2 { border-bottom: 1px solid #ddd; padding-bottom: .25rem; margin-top: 2rem; }
+ul { list-style: none; padding: 0; }
+li { display: flex; justify-content: space-between; gap: 1rem; padding: .25rem 0; }
+.details { color: #777; white-space: nowrap; }
+</style>
+</head>
+<body>
+<h1>{{.CourseName}}</h1>
+<p>{{if .Year}}{{.Year}} · {{end}}{{len .Files}} files · exported on {{.Exported}}</p>
+{{range .Sections}}<h2>{{.Name}}</h2>
+<ul>
+{{range .Files}}<li><a href="{{.Path}}">{{.Name}}</a><span class="details">{{if .Module}}{{.Module}} · {{end}}{{.Size}}</span></li>
+{{end}}</ul>
+{{end}}{{if .Missing}}<h2>Not included</h2>
+<ul>
+{{range .Missing}}<li>{{.}}</li>
+{{end}}</ul>
+{{end}}</body>
+</html>
+`))
+
+type indexSection struct {
+	Name  string
+	Files []indexFile
+}
+
+type indexFile struct {
+	Name   string
+	Path   string
+	Module string
+	Size   string
+}
+
+// indexPage is the data of the index template
+type indexPage struct {
+	CourseName string
+	Year       string
+	Exported   string
+	Files      []ManifestFile
+	Sections   []indexSection
+	Missing    []string
+}
+
+// indexData groups the files of the manifest by section, in the order they were listed
+func indexData(manifest Manifest) indexPage {
+	page := indexPage{
+		CourseName: manifest.CourseName,
+		Year:       manifest.Year,
+		Exported:   manifest.Exported.Format(time.DateOnly),
+		Files:      manifest.Files,
+		Missing:    manifest.Missing,
+	}
+	positions := make(map[string]int)
+	for _, file := range manifest.Files {
+		i, ok := positions[file.Section]
+		if !ok {
+			i = len(page.Sections)
+			positions[file.Section] = i
+			page.Sections = append(page.Sections, indexSection{Name: file.Section})
+		}
+		page.Sections[i].Files = append(page.Sections[i].Files, indexFile{
+			Name:   path.Base(file.Path),
+			Path:   file.Path,
+			Module: file.Module,
+			Size:   types.FormatBytes(file.Size),
+		})
+	}
+	return page
+}
@@ -0,0 +1,213 @@
+package files
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	logging "github.com/Astrak00/AGDownloader/logging"
+	types "github.com/Astrak00/AGDownloader/types"
+)
+
+// CollisionPolicy decides how a file whose destination is already taken is renamed
+type CollisionPolicy string
+
+const (
+	// CollisionModule adds the name of the module to the file name, e.g. "slides (Lab 1).pdf",
+	// and falls back to a number if that name is also taken
+	CollisionModule CollisionPolicy = "module"
+	// CollisionNumeric adds a number to the file name, e.g. "slides (2).pdf"
+	CollisionNumeric CollisionPolicy = "numeric"
+)
+
+// ParseCollisionPolicy validates the name of a collision policy
+func ParseCollisionPolicy(policy string) (CollisionPolicy, error) {
+	switch CollisionPolicy(policy) {
+	case CollisionModule, CollisionNumeric:
+		return CollisionPolicy(policy), nil
+	case "":
+		return CollisionModule, nil
+	}
+	return "", fmt.Errorf("unknown collision policy %q (module, numeric)", policy)
+}
+
+// Rename is a file that was saved with a different name to avoid overwriting another one
+type Rename struct {
+	CourseID string
+	From     string
+	To       string
+}
+
+// Collisions records the files renamed during the listing
+type Collisions struct {
+	Policy CollisionPolicy
+
+	mu      sync.Mutex
+	renamed []Rename
+}
+
+// NewCollisions creates a collision report using the given policy
+func NewCollisions(policy CollisionPolicy) *Collisions {
+	return &Collisions{Policy: policy}
+}
+
+// Renamed returns the files that were renamed, sorted by course and path
+func (c *Collisions) Renamed() []Rename {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	renamed := append([]Rename(nil), c.renamed...)
+	c.mu.Unlock()
+
+	sort.Slice(renamed, func(i, j int) bool {
+		if renamed[i].CourseID != renamed[j].CourseID {
+			return compareCourseIDs(renamed[i].CourseID, renamed[j].CourseID) < 0
+		}
+		return renamed[i].From < renamed[j].From
+	})
+	return renamed
+}
+
+func (c *Collisions) add(rename Rename) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.renamed = append(c.renamed, rename)
+	c.mu.Unlock()
+	slog.Debug("File renamed to avoid overwriting another one", logging.KeyCourseID, rename.CourseID, "from", rename.From, "to", rename.To)
+}
+
+// collisionKey compares paths ignoring the case if the target does, as macOS and Windows do
+func collisionKey(path string, target Target) string {
+	path = filepath.Clean(path)
+	if target.caseInsensitive() {
+		return strings.ToLower(path)
+	}
+	return path
+}
+
+// listedCourse is a course with the files that will be downloaded, before their collisions are resolved
+type listedCourse struct {
+	id    string
+	files []types.File
+}
+
+// resolveCollisions renames the files whose destination is already taken by a previous file, of the same course
+// or of another one, as a layout without {course} or {course_id} sends several courses to the same directories.
+// The courses are listed concurrently, so they are resolved once all of them are listed, sorted by ID, and their
+// files in the order returned by AulaGlobal; the same file always gets the same name.
+func (c *Collisions) resolveCollisions(listed []listedCourse, target Target) []listedCourse {
+	policy := CollisionModule
+	if c != nil {
+		policy = c.Policy
+	}
+
+	sorted := slices.Clone(listed)
+	slices.SortStableFunc(sorted, func(a, b listedCourse) int {
+		return compareCourseIDs(a.id, b.id)
+	})
+
+	claimed := make(map[string]struct{})
+	for i, course := range sorted {
+		resolved := make([]types.File, 0, len(course.files))
+		for _, file := range course.files {
+			name := file.FileName
+			if _, taken := claimed[collisionKey(name, target)]; taken {
+				name = disambiguate(file, policy, target, claimed)
+				c.add(Rename{CourseID: course.id, From: file.FileName, To: name})
+				file.FileName = name
+			}
+			claimed[collisionKey(name, target)] = struct{}{}
+			resolved = append(resolved, file)
+		}
+		sorted[i].files = resolved
+	}
+	return sorted
+}
+
+// compareCourseIDs sorts the IDs as numbers, and the ones that are not numbers after them
+func compareCourseIDs(a, b string) int {
+	numberA, errA := strconv.Atoi(a)
+	numberB, errB := strconv.Atoi(b)
+	switch {
+	case errA == nil && errB == nil:
+		return cmp.Compare(numberA, numberB)
+	case errA == nil:
+		return -1
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// disambiguate returns the first free name for the file following the policy
+func disambiguate(file types.File, policy CollisionPolicy, target Target, claimed map[string]struct{}) string {
+	dir, name := filepath.Split(file.FileName)
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	if policy == CollisionModule && file.ModuleName != "" {
+		candidate := target.Component(fmt.Sprintf("%s (%s)%s", base, file.ModuleName, ext))
+		if _, taken := claimed[collisionKey(dir+candidate, target)]; !taken {
+			return dir + candidate
+		}
+		base = strings.TrimSuffix(candidate, ext)
+	}
+
+	for n := 2; ; n++ {
+		candidate := target.Component(fmt.Sprintf("%s (%d)%s", base, n, ext))
+		if _, taken := claimed[collisionKey(dir+candidate, target)]; !taken {
+			return dir + candidate
+		}
+	}
+}
+
+// courseDirNames returns the directory name of every course, which is the one set in its settings or its name.
+// Courses whose names are equal, ignoring the case on the targets that do, get their ID appended so they are not merged into the same directory.
+func courseDirNames(courses []types.Course, overrides map[string]string, target Target) map[string]string {
+	baseName := func(course types.Course) string {
+		if dir, ok := overrides[course.ID]; ok {
+			return target.Component(courseDirName(dir))
+		}
+		return target.Component(courseDirName(course.Name))
+	}
+
+	count := make(map[string]int, len(courses))
+	for _, course := range courses {
+		count[collisionKey(baseName(course), target)]++
+	}
+
+	names := make(map[string]string, len(courses))
+	for _, course := range courses {
+		name := baseName(course)
+		if count[collisionKey(name, target)] > 1 {
+			name = target.Component(fmt.Sprintf("%s (%s)", name, course.ID))
+		}
+		names[course.ID] = name
+	}
+	return names
+}
+
+// dirOverrides returns the directory names set in the settings of the courses
+func (o Options) dirOverrides() map[string]string {
+	overrides := make(map[string]string)
+	for id, course := range o.Courses {
+		if course.Dir != "" {
+			overrides[id] = course.Dir
+		}
+	}
+	return overrides
+}
+
+// courseDirName replaces the "/" in the course name to avoid creating subdirectories
+func courseDirName(name string) string {
+	return strings.ReplaceAll(name, "/", "-")
+}
@@ -0,0 +1,142 @@
+package files
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	types "github.com/Astrak00/AGDownloader/types"
+)
+
+// names returns the destination of every file of the resolved courses, in order
+func names(listed []listedCourse) []string {
+	var result []string
+	for _, course := range listed {
+		for _, file := range course.files {
+			result = append(result, filepath.ToSlash(file.FileName))
+		}
+	}
+	return result
+}
+
+func TestResolveCollisionsPolicies(t *testing.T) {
+	files := []types.File{
+		{FileName: filepath.Join("Tema 1", "slides.pdf"), ModuleName: "Lab 1"},
+		{FileName: filepath.Join("Tema 1", "slides.pdf"), ModuleName: "Lab 2"},
+		{FileName: filepath.Join("Tema 1", "slides.pdf"), ModuleName: "Lab 2"},
+		{FileName: filepath.Join("Tema 1", "slides.pdf")},
+		{FileName: filepath.Join("Tema 2", "slides.pdf"), ModuleName: "Lab 1"},
+		{FileName: filepath.Join("Tema 1", "notes.pdf"), ModuleName: "Lab 1"},
+	}
+	tests := []struct {
+		policy CollisionPolicy
+		want   []string
+	}{
+		{CollisionModule, []string{
+			"Tema 1/slides.pdf",
+			"Tema 1/slides (Lab 2).pdf",
+			"Tema 1/slides (Lab 2) (2).pdf",
+			"Tema 1/slides (2).pdf",
+			"Tema 2/slides.pdf",
+			"Tema 1/notes.pdf",
+		}},
+		{CollisionNumeric, []string{
+			"Tema 1/slides.pdf",
+			"Tema 1/slides (2).pdf",
+			"Tema 1/slides (3).pdf",
+			"Tema 1/slides (4).pdf",
+			"Tema 2/slides.pdf",
+			"Tema 1/notes.pdf",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			collisions := NewCollisions(tt.policy)
+			got := names(collisions.resolveCollisions([]listedCourse{{id: "1", files: files}}, TargetPosix))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolveCollisions = %q, want %q", got, tt.want)
+			}
+			// The files without a collision keep their name and are not reported
+			if renamed := collisions.Renamed(); len(renamed) != 3 {
+				t.Errorf("Renamed() = %v, want 3 files", renamed)
+			}
+		})
+	}
+}
+
+func TestResolveCollisionsCase(t *testing.T) {
+	files := []types.File{{FileName: "Notes.pdf"}, {FileName: "notes.pdf"}}
+	tests := []struct {
+		target Target
+		want   []string
+	}{
+		{TargetPosix, []string{"Notes.pdf", "notes.pdf"}},
+		{TargetWindows, []string{"Notes.pdf", "notes_(2).pdf"}}, // The spaces are replaced on Windows
+		{TargetMacOS, []string{"Notes.pdf", "notes (2).pdf"}},
+	}
+	for _, tt := range tests {
+		got := names(NewCollisions(CollisionNumeric).resolveCollisions([]listedCourse{{id: "1", files: files}}, tt.target))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("resolveCollisions on %s = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
+
+// A layout without {course} saves the files of every course in the same directories. The course with the
+// lowest ID keeps the names, whatever the order the courses were listed in.
+func TestResolveCollisionsAcrossCourses(t *testing.T) {
+	layout, err := ParseLayout("{section}/{filename}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	courseFiles := func(course types.Course) listedCourse {
+		listed := listedCourse{id: course.ID}
+		for _, file := range []types.File{
+			{SectionName: "Tema 1", BaseName: "slides.pdf"},
+			{SectionName: "Tema 2", BaseName: "exam.pdf"},
+		} {
+			file.FileName = layout.Path(course, course.Name, file)
+			listed.files = append(listed.files, file)
+		}
+		return listed
+	}
+	algebra := courseFiles(types.Course{ID: "900", Name: "Álgebra"})
+	calculus := courseFiles(types.Course{ID: "1000", Name: "Cálculo"})
+	want := []string{"Tema 1/slides.pdf", "Tema 2/exam.pdf", "Tema 1/slides (2).pdf", "Tema 2/exam (2).pdf"}
+
+	for _, listed := range [][]listedCourse{{algebra, calculus}, {calculus, algebra}} {
+		collisions := NewCollisions(CollisionModule)
+		resolved := collisions.resolveCollisions(listed, TargetPosix)
+		if got := names(resolved); !reflect.DeepEqual(got, want) {
+			t.Errorf("resolveCollisions = %q, want %q", got, want)
+		}
+		if resolved[0].id != "900" || resolved[1].id != "1000" {
+			t.Errorf("courses resolved in order %s, %s, want 900, 1000", resolved[0].id, resolved[1].id)
+		}
+		for _, rename := range collisions.Renamed() {
+			if rename.CourseID != "1000" {
+				t.Errorf("file of course %s renamed, want only the files of course 1000", rename.CourseID)
+			}
+		}
+	}
+}
+
+func TestCompareCourseIDs(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"900", "1000", -1},
+		{"1000", "900", 1},
+		{"12", "12", 0},
+		{"12", "abc", -1},
+		{"abc", "12", 1},
+		{"abc", "abd", -1},
+	}
+	for _, tt := range tests {
+		if got := compareCourseIDs(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareCourseIDs(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package files
+
+import (
+	"os"
+	"time"
+
+	types "github.com/Astrak00/AGDownloader/types"
+)
+
+// IsDownloaded reports whether the file is in the download directory with the size and modification
+// time it has in AulaGlobal, when they are known
+func IsDownloaded(file types.FileStore) bool {
+	info, err := os.Stat(file.Dir)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	if file.FileSize > 0 && info.Size() != file.FileSize {
+		return false
+	}
+	return file.TimeModified == 0 || !info.ModTime().Before(time.Unix(file.TimeModified, 0))
+}
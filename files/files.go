@@ -1,40 +1,104 @@
 package files
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/url"
 	"path/filepath"
-	"regexp"
-	"runtime"
 	"strings"
 	"sync"
+	"time"
 
 	errorlog "github.com/Astrak00/AGDownloader/errorlog"
+	filter "github.com/Astrak00/AGDownloader/filter"
+	logging "github.com/Astrak00/AGDownloader/logging"
+	redact "github.com/Astrak00/AGDownloader/redact"
 	types "github.com/Astrak00/AGDownloader/types"
 )
 
-// ListAllResources Creates a list of all the resources to download
-func ListAllResources(courses []types.Course, userToken string, dirPath string, includeMap *types.FileIncludeExcludeMap, excludeMap *types.FileIncludeExcludeMap, errChan chan error, filesStoreChan chan types.FileStore, errLogger *errorlog.ErrorLogger) {
+// Options configures where and which files are saved
+type Options struct {
+	DirPath    string
+	Filter     *filter.Rules            // Decides which files are downloaded, nil downloads every file
+	Explain    *filter.Report           // Records the rule that decided every file, nil disables it
+	Collisions *Collisions              // Renames the files whose destination is already taken
+	Layout     *Layout                  // Decides the path of every file, nil for the default layout
+	Target     Target                   // File system the names are made valid for, empty for the one of the operating system
+	Courses    map[string]CourseOptions // Settings that replace the ones above for some courses, keyed by course ID
+}
+
+// CourseOptions replace the options of the listing for a single course. Empty fields keep the global value.
+type CourseOptions struct {
+	Dir     string        // Name of the directory of the course
+	Filter  *filter.Rules // Replaces the global rules, that must be included in it
+	Layout  *Layout
+	Modules map[string]struct{} // Types of module whose files are downloaded, empty downloads all
+}
+
+// forCourse returns the options that apply to a course
+func (o Options) forCourse(courseID string) (Options, map[string]struct{}) {
+	course, ok := o.Courses[courseID]
+	if !ok {
+		return o, nil
+	}
+	if course.Filter != nil {
+		o.Filter = course.Filter
+	}
+	if course.Layout != nil {
+		o.Layout = course.Layout
+	}
+	return o, course.Modules
+}
+
+// ListAllResources Creates a list of all the resources to download.
+// The files are sent once every course is listed, so the collisions between courses are always resolved the same way.
+// Once the context is cancelled, no more courses are listed and no more files are sent.
+func ListAllResources(ctx context.Context, courses []types.Course, userToken string, opts Options, errChan chan error, filesStoreChan chan types.FileStore, errLogger *errorlog.ErrorLogger) {
+	// The directory names are decided before listing, so courses with the same name are never merged
+	dirNames := courseDirNames(courses, opts.dirOverrides(), opts.Target)
+
+	listed := make([]listedCourse, len(courses))
 	var wg sync.WaitGroup
-	for _, courseItem := range courses {
+	for i, courseItem := range courses {
 		wg.Add(1)
-		go func(courseItem types.Course) {
+		go func(i int, courseItem types.Course) {
+			defer redact.Recover()
 			defer wg.Done()
-			// Passing chan <- types.FileStore(filesStoreChan) as a parameter to the function makes the channel
+			// Passing chan <- error(errChan) as a parameter to the function makes the channel
 			// to be a parameter of the function, so it can be used inside the function and a send-only channel
-			processCourse(courseItem, userToken, dirPath, includeMap, excludeMap, chan<- error(errChan), chan<- types.FileStore(filesStoreChan), errLogger)
-		}(courseItem)
+			listed[i] = listedCourse{id: courseItem.ID, files: processCourse(ctx, courseItem, dirNames[courseItem.ID], userToken, opts, chan<- error(errChan), errLogger)}
+		}(i, courseItem)
 	}
 
 	wg.Wait()
+	if ctx.Err() != nil {
+		return
+	}
+
+	// Two files may have the same destination, e.g. two modules of the same section with a "slides.pdf",
+	// two names that are only different in characters that are not valid in the target
+	// or two courses saved in the same directory by the layout
+	for _, course := range opts.Collisions.resolveCollisions(listed, opts.Target) {
+		catalogFiles(ctx, course.id, userToken, course.files, opts.DirPath, chan<- types.FileStore(filesStoreChan))
+	}
 }
 
-// Parses the course for available files and sends them to the channel to be downloaded
-func processCourse(course types.Course, userToken string, dirPath string, includeMap *types.FileIncludeExcludeMap, excludeMap *types.FileIncludeExcludeMap, errChan chan<- error, filesStoreChan chan<- types.FileStore, errLogger *errorlog.ErrorLogger) {
-	files, err := getCourseContent(userToken, course.ID)
+// Parses the course and returns the files to be downloaded
+func processCourse(ctx context.Context, course types.Course, courseDir string, userToken string, opts Options, errChan chan<- error, errLogger *errorlog.ErrorLogger) []types.File {
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	files, err := getCourseContent(ctx, userToken, course.ID)
+	if ctx.Err() != nil {
+		// The error is caused by the cancellation, there is nothing to report
+		return nil
+	}
 	if err != nil {
-		errChan <- fmt.Errorf("error getting course content: %v", err)
+		slog.Error("Error getting course content", logging.KeyCourseID, course.ID, logging.KeyCourseName, course.Name, logging.KeyError, err)
+		errChan <- fmt.Errorf("error getting course content: %v", redact.Error(err))
 
 		// Log error to file
 		if errLogger != nil {
@@ -43,53 +107,47 @@ func processCourse(course types.Course, userToken string, dirPath string, includ
 				fmt.Sprintf("Failed to get content for course: %s", course.Name),
 				err,
 				map[string]string{
-					"course_id":   course.ID,
-					"course_name": course.Name,
+					errorlog.DetailCourseID:   course.ID,
+					errorlog.DetailCourseName: course.Name,
 				},
 			)
 		}
 		// If there's an error, we skip processing this course and move on to the next one
-		return
-	}
-	if len(files) > 0 {
-		// Replace the "/" in the course name to avoid creating subdirectories
-		courseName := strings.ReplaceAll(course.Name, "/", "-")
-		catalogFiles(courseName, userToken, files, dirPath, includeMap, excludeMap, filesStoreChan)
+		return nil
 	}
-}
+	slog.Debug("Listed course content", logging.KeyCourseID, course.ID, "files", len(files))
+	opts, modules := opts.forCourse(course.ID)
+	files = filterModules(files, modules, opts.Explain)
 
-func sanitizePath(path string) string {
-	if runtime.GOOS == "windows" {
-		invalidChars := []string{"<", ">", ":", "\"", "\\", "|", "?", "*"}
-		for _, char := range invalidChars {
-			path = strings.ReplaceAll(path, char, "_")
-		}
-		path = regexp.MustCompile(`\s*_\s*`).ReplaceAllString(path, "_")
-		path = regexp.MustCompile(`\s+`).ReplaceAllString(path, "_")
-		path = strings.TrimSpace(path)
-		path = strings.Trim(path, ".")
+	// The destination of every file is decided by the layout, relative to the download directory,
+	// and made valid for the target file system. The filter rules are checked against it.
+	for i := range files {
+		files[i].FileName = opts.Target.Path(opts.DirPath, opts.Layout.Path(course, courseDir, files[i]))
 	}
-	return path
+	return filterFiles(files, opts.Filter, opts.Explain)
 }
 
 // Parses the course and returns the files of type "file"
 // Fetches the course content from the moodle API
 // Scrapes the file names, urls and types with regex
-func getCourseContent(token, courseID string) ([]types.File, error) {
+func getCourseContent(ctx context.Context, token, courseID string) ([]types.File, error) {
 	url := fmt.Sprintf("https://%s%s?wstoken=%s&wsfunction=core_course_get_contents&moodlewsrestformat=json&courseid=%s", types.Domain, types.Webservice, token, courseID)
 	// Get the json from the URL
-	jsonData := types.GetJson(url)
+	jsonData, err := types.GetJsonContext(ctx, url)
+	if err != nil {
+		return nil, err
+	}
 
 	// Parse the json
 	var courseParsed types.WebCourse
-	err := json.Unmarshal(jsonData, &courseParsed)
+	err = json.Unmarshal(jsonData, &courseParsed)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("error parsing the course content: %v", err)
 	}
 
 	// Get the names, urls and types of the files
 	filesPresentInCourse := make([]types.File, 0)
-	for _, course := range courseParsed {
+	for sectionNum, course := range courseParsed {
 		if len(course.Modules) == 0 {
 			continue
 		}
@@ -107,22 +165,23 @@ func getCourseContent(token, courseID string) ([]types.File, error) {
 			sectionName = removeTags(course.Summary)
 		}
 
-		if runtime.GOOS == "windows" {
-			sectionName = sanitizePath(sectionName)
-		}
-
 		for _, module := range course.Modules {
 			for _, content := range module.Contents {
 
 				switch content.Type {
 				case "file":
 					fileName := content.Filename
-					if runtime.GOOS == "windows" {
-						fileName = sanitizePath(fileName)
-					}
 					filesPresentInCourse = append(filesPresentInCourse, types.File{
-						FileName: filepath.Join(sectionName, fileName),
-						FileURL:  content.Fileurl,
+						FileName:     filepath.Join(sectionName, fileName),
+						FileURL:      content.Fileurl,
+						FileSize:     int64(content.Filesize),
+						TimeModified: int64(content.Timemodified),
+						ModuleName:   module.Name,
+						ModuleType:   module.Modname,
+						SectionName:  sectionName,
+						SectionNum:   sectionNum,
+						BaseName:     fileName,
+						MimeType:     content.Mimetype,
 					})
 				default:
 					continue
@@ -158,43 +217,97 @@ func removeTags(s string) string {
 	return strings.Trim(string(result), " ")
 }
 
-// Formats the files to be downloaded, adding the course name and sends them to the channel
-func catalogFiles(courseName string, token string, files []types.File, dirPath string, includeMap *types.FileIncludeExcludeMap, excludeMap *types.FileIncludeExcludeMap, filesStoreChan chan<- types.FileStore) {
+// Formats the files to be downloaded, adding the download directory and sends them to the channel
+func catalogFiles(ctx context.Context, courseID string, token string, files []types.File, dirPath string, filesStoreChan chan<- types.FileStore) {
 
 	for _, file := range files {
-		if !shouldDownload(file.FileName, includeMap, excludeMap) {
-			continue
+		url := withToken(file.FileURL, token)
+		filePath := filepath.Join(dirPath, file.FileName)
+
+		// Send the file to the channel, unless the listing has been cancelled
+		select {
+		case filesStoreChan <- types.FileStore{
+			FileName:     file.FileName,
+			FileURL:      url,
+			Dir:          filePath,
+			FileSize:     file.FileSize,
+			TimeModified: file.TimeModified,
+			CourseID:     courseID,
+			SectionName:  file.SectionName,
+			ModuleName:   file.ModuleName,
+		}:
+		case <-ctx.Done():
+			return
 		}
-		url := file.FileURL + "&token=" + token
-		filePath := filepath.Join(dirPath, courseName, file.FileName)
+	}
+}
 
-		// Send the file to the channel
-		filesStoreChan <- types.FileStore{FileName: file.FileName, FileURL: url, Dir: filePath}
+// withToken adds the token to the URL of a file, replacing any previous (or redacted) one
+func withToken(fileURL string, token string) string {
+	parsed, err := url.Parse(fileURL)
+	if err != nil {
+		return fileURL + "&token=" + token
 	}
+	query := parsed.Query()
+	query.Set("token", token)
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
 }
 
-func shouldDownload(fileName string, includeMap *types.FileIncludeExcludeMap, excludeMap *types.FileIncludeExcludeMap) bool {
-	if len(*includeMap) == 0 {
-		return true
+// FileStoresFromRecords rebuilds the downloads that failed in a previous run from its error log records
+func FileStoresFromRecords(records []errorlog.Record, token string) []types.FileStore {
+	stores := make([]types.FileStore, 0, len(records))
+	for _, record := range errorlog.FailedDownloads(records) {
+		stores = append(stores, types.FileStore{
+			FileName:     record.File,
+			FileURL:      withToken(record.URL, token),
+			Dir:          record.Path,
+			CourseID:     record.CourseID,
+			TimeModified: record.TimeModified, // 0 in the logs of older versions, the current time is kept
+		})
 	}
+	return stores
+}
 
-	ext := strings.ToLower(filepath.Ext(fileName))
-	if len(ext) > 0 && ext[0] == '.' {
-		ext = ext[1:]
+// filterModules keeps only the files of the enabled module types, if there is any
+func filterModules(files []types.File, modules map[string]struct{}, report *filter.Report) []types.File {
+	if len(modules) == 0 {
+		return files
 	}
+	filtered := make([]types.File, 0, len(files))
+	for _, file := range files {
+		if _, ok := modules[file.ModuleType]; !ok {
+			reason := fmt.Sprintf("module type %q is not enabled in the course settings", file.ModuleType)
+			report.Record(filter.Decision{Path: filepath.ToSlash(file.FileName), Included: false, Reason: reason})
+			slog.Debug("Skipping file of a disabled module type", logging.KeyFile, file.FileName, "module_type", file.ModuleType)
+			continue
+		}
+		filtered = append(filtered, file)
+	}
+	return filtered
+}
 
-	// If include map is provided, only allow those extensions
-	if len(*includeMap) > 0 {
-		if _, ok := (*includeMap)[ext]; ok {
-			return true
+// filterFiles keeps only the files that should be downloaded, checking the rules against their
+// destination. The decisions are added to the report, if there is one.
+func filterFiles(files []types.File, rules *filter.Rules, report *filter.Report) []types.File {
+	filtered := make([]types.File, 0, len(files))
+	for _, file := range files {
+		entry := filter.Entry{
+			Path:     filepath.ToSlash(file.FileName),
+			Size:     file.FileSize,
+			MimeType: file.MimeType,
 		}
-		return false
-	} else if len(*excludeMap) > 0 {
-		if _, ok := (*excludeMap)[ext]; ok {
-			return false
+		if file.TimeModified > 0 {
+			entry.Modified = time.Unix(file.TimeModified, 0)
 		}
-		return true
-	}
 
-	return true
+		included, rule := rules.Match(entry)
+		report.Record(filter.Decision{Path: entry.Path, Included: included, Reason: rules.Describe(rule)})
+		if !included {
+			slog.Debug("Skipping filtered file", logging.KeyFile, file.FileName, "rule", rules.Describe(rule))
+			continue
+		}
+		filtered = append(filtered, file)
+	}
+	return filtered
 }
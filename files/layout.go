@@ -0,0 +1,228 @@
+package files
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	types "github.com/Astrak00/AGDownloader/types"
+)
+
+// DefaultLayout saves the files as previous versions did: one directory per course and section
+const DefaultLayout = "{course}/{section}/{filename}"
+
+// layoutVariables describes the variables that can be used in a layout, and whether they are numbers
+var layoutVariables = map[string]bool{
+	"course":       false, // Name of the course, as shown in the selector
+	"course_id":    true,  // ID of the course in AulaGlobal
+	"course_short": false, // Short name of the course
+	"course_full":  false, // Full name of the course, in both languages
+	"category":     false, // Category of the course
+	"year":         false, // Academic year the course starts in, e.g. 2024-25
+	"semester":     true,  // 1 if the course starts between July and December, 2 otherwise
+	"start_date":   false, // Start date of the course, e.g. 2024-09-09
+	"section":      false, // Name of the section, empty for the general section
+	"section_num":  true,  // Position of the section in the course, starting at 0
+	"module":       false, // Name of the module that contains the file
+	"modname":      false, // Type of the module: resource, folder, assign...
+	"filename":     false, // Name of the file
+}
+
+var layoutVariableRegex = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// layoutPart is a literal text or a variable of a layout segment
+type layoutPart struct {
+	literal  string
+	variable string
+	width    int // Minimum width of a number, padded with zeros
+}
+
+// Layout is a validated path template for the downloaded files
+type Layout struct {
+	template string
+	segments [][]layoutPart // One list of parts for every directory of the template
+}
+
+// ParseLayout validates a path template such as "{year}/{course_short}/{section_num:02} {section}/{filename}".
+// An empty template returns the default layout.
+func ParseLayout(template string) (*Layout, error) {
+	if strings.TrimSpace(template) == "" {
+		template = DefaultLayout
+	}
+	if strings.Contains(template, "\\") {
+		return nil, fmt.Errorf("invalid layout %q: use \"/\" to separate directories", template)
+	}
+	if strings.HasPrefix(template, "/") {
+		return nil, fmt.Errorf("invalid layout %q: the path must be relative to the download directory", template)
+	}
+
+	layout := &Layout{template: template}
+	hasFilename := false
+	segments := strings.Split(template, "/")
+	for i, segment := range segments {
+		if segment == "." || segment == ".." {
+			return nil, fmt.Errorf("invalid layout %q: %q is not allowed", template, segment)
+		}
+
+		parts, err := parseSegment(segment)
+		if err != nil {
+			return nil, fmt.Errorf("invalid layout %q: %v", template, err)
+		}
+		for _, part := range parts {
+			if part.variable != "filename" {
+				continue
+			}
+			// Every file would be created as a directory
+			if i != len(segments)-1 {
+				return nil, fmt.Errorf("invalid layout %q: {filename} must be in the last part of the path", template)
+			}
+			hasFilename = true
+		}
+		layout.segments = append(layout.segments, parts)
+	}
+
+	if !hasFilename {
+		return nil, fmt.Errorf("invalid layout %q: it must contain {filename}", template)
+	}
+	return layout, nil
+}
+
+// parseSegment splits a directory of the template into literals and variables
+func parseSegment(segment string) ([]layoutPart, error) {
+	var parts []layoutPart
+	last := 0
+	for _, match := range layoutVariableRegex.FindAllStringSubmatchIndex(segment, -1) {
+		if literal := segment[last:match[0]]; literal != "" {
+			if strings.ContainsAny(literal, "{}") {
+				return nil, fmt.Errorf("unbalanced braces in %q", segment)
+			}
+			parts = append(parts, layoutPart{literal: literal})
+		}
+		last = match[1]
+
+		part, err := parseVariable(segment[match[2]:match[3]])
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+	}
+	if literal := segment[last:]; literal != "" {
+		if strings.ContainsAny(literal, "{}") {
+			return nil, fmt.Errorf("unbalanced braces in %q", segment)
+		}
+		parts = append(parts, layoutPart{literal: literal})
+	}
+	return parts, nil
+}
+
+// parseVariable parses a variable such as "section_num:02"
+func parseVariable(variable string) (layoutPart, error) {
+	name, format, hasFormat := strings.Cut(variable, ":")
+	isNumber, ok := layoutVariables[name]
+	if !ok {
+		return layoutPart{}, fmt.Errorf("unknown variable {%s} (%s)", name, strings.Join(LayoutVariables(), ", "))
+	}
+
+	part := layoutPart{variable: name}
+	if hasFormat {
+		if !isNumber {
+			return layoutPart{}, fmt.Errorf("{%s} is not a number and cannot be formatted", name)
+		}
+		width, err := strconv.Atoi(format)
+		if err != nil || !strings.HasPrefix(format, "0") || width <= 0 || width > 10 {
+			return layoutPart{}, fmt.Errorf("invalid format %q for {%s}, use a zero-padded width such as 02", format, name)
+		}
+		part.width = width
+	}
+	return part, nil
+}
+
+// LayoutVariables returns the names of the variables that can be used in a layout
+func LayoutVariables() []string {
+	names := make([]string, 0, len(layoutVariables))
+	for name := range layoutVariables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// String returns the template of the layout
+func (l *Layout) String() string {
+	if l == nil {
+		return DefaultLayout
+	}
+	return l.template
+}
+
+// defaultLayout is the layout used when none is given
+var defaultLayout, _ = ParseLayout(DefaultLayout)
+
+// Path returns the destination of a file relative to the download directory.
+// Empty directories, e.g. the section of the general section, are left out.
+func (l *Layout) Path(course types.Course, courseDir string, file types.File) string {
+	if l == nil {
+		l = defaultLayout
+	}
+	values := layoutValues(course, courseDir, file)
+
+	dirs := make([]string, 0, len(l.segments))
+	for _, parts := range l.segments {
+		var builder strings.Builder
+		for _, part := range parts {
+			if part.variable == "" {
+				builder.WriteString(part.literal)
+				continue
+			}
+			value := values[part.variable]
+			if part.width > 0 {
+				if number, err := strconv.Atoi(value); err == nil {
+					value = fmt.Sprintf("%0*d", part.width, number)
+				}
+			}
+			builder.WriteString(value)
+		}
+
+		dir := strings.TrimSpace(builder.String())
+		if dir == "" || dir == "." || dir == ".." {
+			continue
+		}
+		dirs = append(dirs, dir)
+	}
+	return filepath.Join(dirs...)
+}
+
+// layoutValues returns the value of every variable for a file, without any "/" that would create a directory.
+// The names are made valid for the target file system once the path is complete.
+func layoutValues(course types.Course, courseDir string, file types.File) map[string]string {
+	year, semester, startDate := "", "", ""
+	if startYear, startSemester := course.AcademicYear(); startYear > 0 {
+		year = types.FormatAcademicYear(startYear, "-")
+		semester = strconv.Itoa(startSemester)
+		startDate = time.Unix(course.StartDate, 0).Format("2006-01-02")
+	}
+
+	values := map[string]string{
+		"course":       courseDir,
+		"course_id":    course.ID,
+		"course_short": course.ShortName,
+		"course_full":  course.FullName,
+		"category":     course.Category,
+		"year":         year,
+		"semester":     semester,
+		"start_date":   startDate,
+		"section":      file.SectionName,
+		"section_num":  strconv.Itoa(file.SectionNum),
+		"module":       file.ModuleName,
+		"modname":      file.ModuleType,
+		"filename":     file.BaseName,
+	}
+	for name, value := range values {
+		values[name] = strings.NewReplacer("/", "-", "\\", "-").Replace(value)
+	}
+	return values
+}
@@ -0,0 +1,85 @@
+package files
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	coursename "github.com/Astrak00/AGDownloader/coursename"
+	types "github.com/Astrak00/AGDownloader/types"
+)
+
+// The default layout must keep the folders created by previous versions, which replaced the "/" of the name
+func TestDefaultLayoutKeepsPreviousFolders(t *testing.T) {
+	name := (&coursename.Parser{}).Parse(coursename.Input{ID: "123", FullName: "Cálculo 23/24-1C"}, coursename.Spanish)
+	course := types.Course{ID: "123", Name: name.Name}
+	dirs := courseDirNames([]types.Course{course}, nil, TargetPosix)
+
+	got := (*Layout)(nil).Path(course, dirs[course.ID], types.File{SectionName: "Tema 1", BaseName: "apuntes.pdf"})
+	if want := filepath.Join("Cálculo 23-24-1C", "Tema 1", "apuntes.pdf"); got != want {
+		t.Errorf("Path = %q, want %q", got, want)
+	}
+}
+
+func TestLayoutPath(t *testing.T) {
+	course := types.Course{
+		ID:        "123",
+		Name:      "Cálculo",
+		ShortName: "CAL",
+		FullName:  "Cálculo 24/25-1C Calculus 24/25-S1",
+		Category:  "7",
+		StartDate: time.Date(2024, time.September, 9, 12, 0, 0, 0, time.Local).Unix(),
+	}
+	file := types.File{SectionName: "Tema 1", SectionNum: 3, ModuleName: "Lab 1/2", ModuleType: "resource", BaseName: "slides.pdf"}
+
+	tests := []struct {
+		layout string
+		file   types.File
+		want   string
+	}{
+		{"", file, "Cálculo/Tema 1/slides.pdf"},
+		{"{course_id}/{filename}", file, "123/slides.pdf"},
+		{"{year}/{semester}/{course_short}/{section_num:02} {section}/{module}/{filename}", file, "2024-25/1/CAL/03 Tema 1/Lab 1-2/slides.pdf"},
+		{"{course_full}/{category}/{start_date}/{modname}/{filename}", file, "Cálculo 24-25-1C Calculus 24-25-S1/7/2024-09-09/resource/slides.pdf"},
+		{"{course}/{course_id:04} {filename}", file, "Cálculo/0123 slides.pdf"},
+		// The general section has no name, its directory is left out
+		{"", types.File{BaseName: "guide.pdf"}, "Cálculo/guide.pdf"},
+	}
+	for _, tt := range tests {
+		layout, err := ParseLayout(tt.layout)
+		if err != nil {
+			t.Fatalf("ParseLayout(%q): %v", tt.layout, err)
+		}
+		if got := filepath.ToSlash(layout.Path(course, course.Name, tt.file)); got != tt.want {
+			t.Errorf("layout %q: Path = %q, want %q", tt.layout, got, tt.want)
+		}
+	}
+}
+
+func TestParseLayoutInvalid(t *testing.T) {
+	tests := []struct {
+		layout string
+		err    string
+	}{
+		{"{course}/{section}", "it must contain {filename}"},
+		{"{filename}/{course}", "{filename} must be in the last part of the path"},
+		{"{course}/{filename}/x", "{filename} must be in the last part of the path"},
+		{"/{course}/{filename}", "the path must be relative to the download directory"},
+		{`{course}\{filename}`, `use "/" to separate directories`},
+		{"{course}/../{filename}", `".." is not allowed`},
+		{"{course}/./{filename}", `"." is not allowed`},
+		{"{teacher}/{filename}", "unknown variable {teacher}"},
+		{"{course:02}/{filename}", "{course} is not a number and cannot be formatted"},
+		{"{section_num:2}/{filename}", `invalid format "2" for {section_num}`},
+		{"{section_num:011}/{filename}", `invalid format "011" for {section_num}`},
+		{"{course/{filename}", "unbalanced braces"},
+		{"{course}}/{filename}", "unbalanced braces"},
+	}
+	for _, tt := range tests {
+		_, err := ParseLayout(tt.layout)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("ParseLayout(%q) = %v, want an error containing %q", tt.layout, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package files
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Target is the file system the names are made valid for
+type Target string
+
+const (
+	// TargetPosix only forbids "/" and limits the names to 255 bytes (Linux, BSD)
+	TargetPosix Target = "posix"
+	// TargetWindows forbids <>:"\|?*, reserved names such as CON or NUL and trailing dots and spaces (NTFS, exFAT, SMB)
+	TargetWindows Target = "windows"
+	// TargetMacOS forbids ":", which Finder shows as "/"
+	TargetMacOS Target = "macos"
+	// TargetPortable applies the rules of every target, for names that are valid everywhere
+	TargetPortable Target = "portable"
+)
+
+const (
+	maxComponentLength = 255 // Maximum length of a file or directory name, in the units of the target
+	hashSuffixLength   = 8   // Hexadecimal characters of the hash added to a truncated name
+	maxExtensionLength = 16  // Longer extensions are truncated with the rest of the name
+)
+
+// reservedNames can't be used as a file name on Windows, even with an extension
+var reservedNames = map[string]struct{}{
+	"CON": {}, "PRN": {}, "AUX": {}, "NUL": {},
+	"COM1": {}, "COM2": {}, "COM3": {}, "COM4": {}, "COM5": {}, "COM6": {}, "COM7": {}, "COM8": {}, "COM9": {},
+	"LPT1": {}, "LPT2": {}, "LPT3": {}, "LPT4": {}, "LPT5": {}, "LPT6": {}, "LPT7": {}, "LPT8": {}, "LPT9": {},
+}
+
+var (
+	windowsInvalidChars = strings.NewReplacer("<", "_", ">", "_", ":", "_", "\"", "_", "\\", "_", "|", "_", "?", "_", "*", "_")
+	underscoreSpaces    = regexp.MustCompile(`\s*_\s*`)
+	spaces              = regexp.MustCompile(`\s+`)
+)
+
+// NativeTarget returns the target of the operating system the program runs on
+func NativeTarget() Target {
+	switch runtime.GOOS {
+	case "windows":
+		return TargetWindows
+	case "darwin", "ios":
+		return TargetMacOS
+	}
+	return TargetPosix
+}
+
+// ParseTarget validates the name of a target. An empty name returns the target of the operating system.
+func ParseTarget(target string) (Target, error) {
+	switch Target(target) {
+	case TargetPosix, TargetWindows, TargetMacOS, TargetPortable:
+		return Target(target), nil
+	case "":
+		return NativeTarget(), nil
+	}
+	return "", fmt.Errorf("unknown sanitization target %q (posix, windows, macos, portable)", target)
+}
+
+// resolve returns the target of the operating system if none was chosen
+func (t Target) resolve() Target {
+	if t == "" {
+		return NativeTarget()
+	}
+	return t
+}
+
+// caseInsensitive reports whether names that only differ in the case are the same file, as on macOS and Windows
+func (t Target) caseInsensitive() bool {
+	t = t.resolve()
+	return t == TargetWindows || t == TargetMacOS || t == TargetPortable
+}
+
+func (t Target) isWindows() bool {
+	return t == TargetWindows || t == TargetPortable
+}
+
+// maxPathLength is the maximum length of a full path, including the download directory
+func (t Target) maxPathLength() int {
+	switch t {
+	case TargetWindows, TargetPortable:
+		return 260 // MAX_PATH, long paths are disabled by default
+	case TargetMacOS:
+		return 1024
+	}
+	return 4096
+}
+
+// length measures a name in the units limited by the target: UTF-16 code units on Windows and bytes elsewhere
+func (t Target) length(name string) int {
+	if t == TargetWindows {
+		return len(utf16.Encode([]rune(name)))
+	}
+	return len(name)
+}
+
+// Component makes a single file or directory name valid for the target
+func (t Target) Component(name string) string {
+	t = t.resolve()
+	name = norm.NFC.String(name)
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == utf8.RuneError {
+			return -1
+		}
+		if r == '/' {
+			return '-'
+		}
+		return r
+	}, name)
+
+	if t == TargetMacOS || t == TargetPortable {
+		name = strings.ReplaceAll(name, ":", "_")
+	}
+	if t.isWindows() {
+		name = strings.TrimRight(windowsInvalidChars.Replace(name), ". ")
+		if t == TargetWindows {
+			// Previous versions replaced the spaces with underscores on Windows, keep the same names
+			name = underscoreSpaces.ReplaceAllString(name, "_")
+			name = spaces.ReplaceAllString(name, "_")
+		}
+		name = strings.TrimRight(name, ". ")
+		if _, reserved := reservedNames[strings.ToUpper(strings.TrimSpace(strings.SplitN(name, ".", 2)[0]))]; reserved {
+			name = "_" + name
+		}
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == ".." {
+		return "_"
+	}
+	return t.truncate(name, maxComponentLength)
+}
+
+// Path makes every component of a path relative to root valid for the target and, if the full path is
+// too long, truncates the longest components until it fits
+func (t Target) Path(root string, path string) string {
+	t = t.resolve()
+	if absolute, err := filepath.Abs(root); err == nil {
+		root = absolute
+	}
+
+	components := strings.Split(filepath.ToSlash(path), "/")
+	kept := components[:0]
+	for _, component := range components {
+		if component == "" {
+			continue
+		}
+		kept = append(kept, t.Component(component))
+	}
+	components = kept
+
+	// The separators and the root count towards the limit
+	available := t.maxPathLength() - t.length(root) - len(components)
+	for {
+		total := 0
+		longest := -1
+		for i, component := range components {
+			total += t.length(component)
+			if longest < 0 || t.length(component) > t.length(components[longest]) {
+				longest = i
+			}
+		}
+		excess := total - available
+		if excess <= 0 || longest < 0 {
+			break
+		}
+
+		// A component can't be shorter than its extension and the hash, give up if the path can't fit
+		limit := t.length(components[longest]) - excess
+		minimum := hashSuffixLength + maxExtensionLength + 2
+		if limit < minimum {
+			limit = minimum
+		}
+		truncated := t.truncate(components[longest], limit)
+		if truncated == components[longest] {
+			break
+		}
+		components[longest] = truncated
+	}
+	return filepath.Join(components...)
+}
+
+// truncate shortens a name that is longer than limit, keeping its extension and adding a hash
+// of the complete name, so two long names with the same beginning don't end up being equal
+func (t Target) truncate(name string, limit int) string {
+	if t.length(name) <= limit {
+		return name
+	}
+
+	ext := filepath.Ext(name)
+	if len(ext) > maxExtensionLength {
+		ext = ""
+	}
+	base := strings.TrimSuffix(name, ext)
+
+	sum := sha256.Sum256([]byte(name))
+	suffix := "~" + hex.EncodeToString(sum[:])[:hashSuffixLength]
+
+	for t.length(base+suffix+ext) > limit && base != "" {
+		_, size := utf8.DecodeLastRuneInString(base)
+		base = base[:len(base)-size]
+	}
+	return strings.TrimRight(base, ". ") + suffix + ext
+}
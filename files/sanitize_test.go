@@ -0,0 +1,94 @@
+package files
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestComponent(t *testing.T) {
+	tests := []struct {
+		target Target
+		name   string
+		want   string
+	}{
+		{TargetPosix, "Tema 1/2: notas?.pdf", "Tema 1-2: notas?.pdf"},
+		{TargetPosix, "con\x00trol\x1f.txt", "control.txt"},
+		{TargetPosix, "  ", "_"},
+		{TargetPosix, "..", "_"},
+		{TargetMacOS, "Tema 1: notas.pdf", "Tema 1_ notas.pdf"},
+		{TargetWindows, `a<b>c:d"e\f|g?h*.txt`, "a_b_c_d_e_f_g_h_.txt"},
+		{TargetWindows, "Tema 1: notas.pdf", "Tema_1_notas.pdf"},
+		{TargetWindows, "notas. . ", "notas"},
+		{TargetWindows, "CON", "_CON"},
+		{TargetWindows, "con.txt", "_con.txt"},
+		{TargetWindows, "lpt1.tar.gz", "_lpt1.tar.gz"},
+		{TargetWindows, "CONSOLE.txt", "CONSOLE.txt"},
+		{TargetPortable, "Tema 1: aux.", "Tema 1_ aux"},
+		{TargetPortable, "AUX.pdf", "_AUX.pdf"},
+		// Decomposed accents are composed, so the same name is always written the same way
+		{TargetPosix, "Ca\u0301lculo", "C\u00e1lculo"},
+	}
+	for _, tt := range tests {
+		if got := tt.target.Component(tt.name); got != tt.want {
+			t.Errorf("%s: Component(%q) = %q, want %q", tt.target, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestComponentTruncatesLongNames(t *testing.T) {
+	long := strings.Repeat("a", 300) + ".pdf"
+	for _, target := range []Target{TargetPosix, TargetWindows, TargetMacOS, TargetPortable} {
+		got := target.Component(long)
+		if target.length(got) > maxComponentLength {
+			t.Errorf("%s: Component returned %d units, want at most %d", target, target.length(got), maxComponentLength)
+		}
+		if !strings.HasSuffix(got, ".pdf") || !strings.Contains(got, "~") {
+			t.Errorf("%s: Component(%q) = %q, want the extension and a hash", target, long, got)
+		}
+	}
+
+	// Two long names with the same beginning stay different
+	other := strings.Repeat("a", 300) + "b.pdf"
+	if TargetPosix.Component(long) == TargetPosix.Component(other) {
+		t.Errorf("two different long names were truncated to the same name")
+	}
+
+	// Windows counts UTF-16 code units, so a name of 200 accented letters fits there but not in 255 bytes
+	accented := strings.Repeat("é", 200)
+	if got := TargetWindows.Component(accented); got != accented {
+		t.Errorf("windows: Component truncated a name of %d UTF-16 units", len(utf16.Encode([]rune(accented))))
+	}
+	if got := TargetPosix.Component(accented); len(got) > maxComponentLength {
+		t.Errorf("posix: Component returned %d bytes, want at most %d", len(got), maxComponentLength)
+	}
+}
+
+func TestPathFitsTheTarget(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(strings.Repeat("curso ", 30), strings.Repeat("tema ", 30), "notas.pdf")
+
+	got := TargetWindows.Path(root, path)
+	absolute, _ := filepath.Abs(root)
+	if length := TargetWindows.length(absolute) + 1 + TargetWindows.length(got); length > TargetWindows.maxPathLength() {
+		t.Errorf("Path returned %q, %d units long with the root, want at most %d", got, length, TargetWindows.maxPathLength())
+	}
+	if filepath.Base(got) != "notas.pdf" {
+		t.Errorf("Path truncated the short file name: %q", got)
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	for _, name := range []string{"posix", "windows", "macos", "portable"} {
+		if target, err := ParseTarget(name); err != nil || string(target) != name {
+			t.Errorf("ParseTarget(%q) = %q, %v", name, target, err)
+		}
+	}
+	if target, err := ParseTarget(""); err != nil || target != NativeTarget() {
+		t.Errorf("ParseTarget(\"\") = %q, %v, want the native target", target, err)
+	}
+	if _, err := ParseTarget("dos"); err == nil {
+		t.Errorf("ParseTarget(\"dos\") succeeded, want an error")
+	}
+}
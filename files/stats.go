@@ -0,0 +1,48 @@
+package files
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	types "github.com/Astrak00/AGDownloader/types"
+)
+
+// Stats are the number of files of a course and their total size, as reported by AulaGlobal
+type Stats struct {
+	Files int
+	Size  int64
+}
+
+// CourseStats obtains the number of files of a course and their size from the summary of every module
+// (contentsinfo), or from its contents if the module has no summary. The filters are not applied.
+func CourseStats(ctx context.Context, token, courseID string) (Stats, error) {
+	url := fmt.Sprintf("https://%s%s?wstoken=%s&wsfunction=core_course_get_contents&moodlewsrestformat=json&courseid=%s", types.Domain, types.Webservice, token, courseID)
+	jsonData, err := types.GetJsonContext(ctx, url)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	var courseParsed types.WebCourse
+	if err := json.Unmarshal(jsonData, &courseParsed); err != nil {
+		return Stats{}, fmt.Errorf("error parsing the course content: %v", err)
+	}
+
+	var stats Stats
+	for _, section := range courseParsed {
+		for _, module := range section.Modules {
+			if module.Contentsinfo != nil {
+				stats.Files += module.Contentsinfo.Filescount
+				stats.Size += int64(module.Contentsinfo.Filessize)
+				continue
+			}
+			for _, content := range module.Contents {
+				if content.Type == "file" {
+					stats.Files++
+					stats.Size += int64(content.Filesize)
+				}
+			}
+		}
+	}
+	return stats, nil
+}
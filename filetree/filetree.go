@@ -0,0 +1,386 @@
+// Package filetree lets the user pick the sections, modules and files to download from a tree of
+// the listed files, before the download starts
+package filetree
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	files "github.com/Astrak00/AGDownloader/files"
+	types "github.com/Astrak00/AGDownloader/types"
+)
+
+// Pick shows the tree of the listed files and returns the ones the user selected, in the order of the tree.
+// The files that are already in the download directory start unselected. It returns false if the user quit.
+func Pick(courses []types.Course, listed []types.FileStore) ([]types.FileStore, bool, error) {
+	m := initialModel(build(courses, listed))
+
+	finalModel, err := tea.NewProgram(m).Run()
+	if err != nil {
+		return nil, false, err
+	}
+	mFinal, ok := finalModel.(model)
+	if !ok || mFinal.cancelled {
+		return nil, false, nil
+	}
+
+	picked := make([]types.FileStore, 0, len(listed))
+	for _, root := range mFinal.roots {
+		root.leaves(func(n *node) {
+			if n.selected {
+				picked = append(picked, *n.file)
+			}
+		})
+	}
+	return picked, true, nil
+}
+
+// node is a course, section, module or file of the tree
+type node struct {
+	label      string
+	depth      int
+	parent     *node
+	children   []*node
+	expanded   bool
+	file       *types.FileStore // nil for the courses, sections and modules
+	selected   bool             // only used by the files
+	downloaded bool             // the file is already in the download directory
+}
+
+// build creates the tree of courses, sections, modules and files, in the order the files were listed.
+// The courses without files are left out.
+func build(courses []types.Course, listed []types.FileStore) []*node {
+	byCourse := make(map[string][]types.FileStore)
+	for _, file := range listed {
+		byCourse[file.CourseID] = append(byCourse[file.CourseID], file)
+	}
+
+	roots := make([]*node, 0, len(courses))
+	for _, course := range courses {
+		courseFiles := byCourse[course.ID]
+		if len(courseFiles) == 0 {
+			continue
+		}
+		root := &node{label: course.Name, expanded: true}
+		for i := range courseFiles {
+			file := &courseFiles[i]
+			section := root.child(file.SectionName, "General")
+			module := section.child(file.ModuleName, "(no module)")
+			downloaded := files.IsDownloaded(*file)
+			module.children = append(module.children, &node{
+				label:      filepath.Base(file.FileName),
+				depth:      module.depth + 1,
+				parent:     module,
+				file:       file,
+				selected:   !downloaded,
+				downloaded: downloaded,
+			})
+		}
+		roots = append(roots, root)
+	}
+	return roots
+}
+
+// child returns the child with the label, adding it if it doesn't exist. Empty labels are replaced with fallback.
+func (n *node) child(label string, fallback string) *node {
+	if label == "" {
+		label = fallback
+	}
+	for _, c := range n.children {
+		if c.label == label && c.file == nil {
+			return c
+		}
+	}
+	c := &node{label: label, depth: n.depth + 1, parent: n}
+	n.children = append(n.children, c)
+	return c
+}
+
+// leaves calls fn for every file under the node, or the node itself if it is a file
+func (n *node) leaves(fn func(*node)) {
+	if n.file != nil {
+		fn(n)
+		return
+	}
+	for _, c := range n.children {
+		c.leaves(fn)
+	}
+}
+
+// counts returns the number of files under the node that are selected, the total number of files
+// and the size of the selected ones
+func (n *node) counts() (selected int, total int, size int64) {
+	n.leaves(func(leaf *node) {
+		total++
+		if leaf.selected {
+			selected++
+			size += leaf.file.FileSize
+		}
+	})
+	return selected, total, size
+}
+
+// setSelected selects or unselects every file under the node
+func (n *node) setSelected(selected bool) {
+	n.leaves(func(leaf *node) { leaf.selected = selected })
+}
+
+var (
+	// headerStyle highlights the title and the courses
+	headerStyle = lipgloss.NewStyle().Bold(true)
+	// detailStyle greys out the sizes, dates and counts
+	detailStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("241"))
+	// downloadedStyle marks the files that are already downloaded
+	downloadedStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+)
+
+type model struct {
+	roots     []*node
+	rows      []*node // nodes on screen: the roots and the children of the expanded nodes
+	cursor    int     // index in rows of the highlighted node
+	offset    int     // index in rows of the first node on screen
+	height    int     // height of the terminal, 0 until it is known
+	done      bool    // signals we've pressed Enter
+	cancelled bool    // signals we've pressed Quit
+	keymap    keymap
+}
+
+// Define key bindings we care about
+type keymap struct {
+	Up       key.Binding
+	Down     key.Binding
+	PageUp   key.Binding
+	PageDown key.Binding
+	Expand   key.Binding
+	Collapse key.Binding
+	Space    key.Binding
+	Enter    key.Binding
+	Quit     key.Binding
+	All      key.Binding
+	None     key.Binding
+}
+
+// initialModel sets up the model with the courses expanded and the sections collapsed
+func initialModel(roots []*node) model {
+	m := model{
+		roots: roots,
+		keymap: keymap{
+			Up:       key.NewBinding(key.WithKeys("up", "k"), key.WithHelp("↑/k", "move up")),
+			Down:     key.NewBinding(key.WithKeys("down", "j"), key.WithHelp("↓/j", "move down")),
+			PageUp:   key.NewBinding(key.WithKeys("pgup"), key.WithHelp("pgup", "previous page")),
+			PageDown: key.NewBinding(key.WithKeys("pgdown"), key.WithHelp("pgdown", "next page")),
+			Expand:   key.NewBinding(key.WithKeys("right", "l"), key.WithHelp("→/l", "expand")),
+			Collapse: key.NewBinding(key.WithKeys("left", "h"), key.WithHelp("←/h", "collapse")),
+			Space:    key.NewBinding(key.WithKeys(" "), key.WithHelp("space", "toggle selection")),
+			Enter:    key.NewBinding(key.WithKeys("enter"), key.WithHelp("enter", "confirm selection")),
+			Quit:     key.NewBinding(key.WithKeys("q", "ctrl+c"), key.WithHelp("q/ctrl+c", "quit")),
+			All:      key.NewBinding(key.WithKeys("*"), key.WithHelp("*", "select all")),
+			None:     key.NewBinding(key.WithKeys("0"), key.WithHelp("0", "select none")),
+		},
+	}
+	m.refresh()
+	return m
+}
+
+// refresh lists the nodes on screen after a node is expanded or collapsed
+func (m *model) refresh() {
+	m.rows = m.rows[:0]
+	var add func(nodes []*node)
+	add = func(nodes []*node) {
+		for _, n := range nodes {
+			m.rows = append(m.rows, n)
+			if n.expanded {
+				add(n.children)
+			}
+		}
+	}
+	add(m.roots)
+	m.move(0)
+}
+
+// Init is called when the program starts. We don't need to do anything here.
+func (m model) Init() tea.Cmd {
+	return nil
+}
+
+// Update handles incoming messages (keypresses, window size changes, etc.)
+func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+
+	case tea.KeyMsg:
+		if len(m.rows) == 0 {
+			if key.Matches(msg, m.keymap.Enter) || key.Matches(msg, m.keymap.Quit) {
+				m.done = true
+				return m, tea.Quit
+			}
+			return m, nil
+		}
+		current := m.rows[m.cursor]
+		switch {
+		case key.Matches(msg, m.keymap.Up):
+			m.move(-1)
+		case key.Matches(msg, m.keymap.Down):
+			m.move(1)
+		case key.Matches(msg, m.keymap.PageUp):
+			m.move(-max(m.pageSize(), 1))
+		case key.Matches(msg, m.keymap.PageDown):
+			m.move(max(m.pageSize(), 1))
+		// Expand the node, or go to its first child if it is already expanded
+		case key.Matches(msg, m.keymap.Expand):
+			if current.file == nil && !current.expanded {
+				current.expanded = true
+				m.refresh()
+			} else if current.file == nil {
+				m.move(1)
+			}
+		// Collapse the node, or go to its parent if it is already collapsed
+		case key.Matches(msg, m.keymap.Collapse):
+			if current.file == nil && current.expanded {
+				current.expanded = false
+				m.refresh()
+			} else if current.parent != nil {
+				for i, n := range m.rows {
+					if n == current.parent {
+						m.cursor = i
+						m.move(0)
+						break
+					}
+				}
+			}
+		// A course, section or module selects all its files, or none if all of them were selected
+		case key.Matches(msg, m.keymap.Space):
+			selected, total, _ := current.counts()
+			current.setSelected(selected < total)
+		case key.Matches(msg, m.keymap.All):
+			for _, root := range m.roots {
+				root.setSelected(true)
+			}
+		case key.Matches(msg, m.keymap.None):
+			for _, root := range m.roots {
+				root.setSelected(false)
+			}
+		case key.Matches(msg, m.keymap.Enter):
+			m.done = true
+			return m, tea.Quit
+		case key.Matches(msg, m.keymap.Quit):
+			m.cancelled = true
+			return m, tea.Quit
+		}
+
+	case tea.WindowSizeMsg:
+		// If the window resizes, keep the cursor on screen
+		m.height = msg.Height
+		m.move(0)
+	}
+
+	return m, nil
+}
+
+// move moves the cursor by delta rows and scrolls to keep it on screen
+func (m *model) move(delta int) {
+	m.cursor = max(0, min(len(m.rows)-1, m.cursor+delta))
+	page := m.pageSize()
+	if page == 0 {
+		m.offset = 0
+		return
+	}
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if m.cursor >= m.offset+page {
+		m.offset = m.cursor - page + 1
+	}
+	m.offset = max(0, min(m.offset, len(m.rows)-page))
+}
+
+// pageSize is the number of rows that fit on screen, 0 if the height of the terminal is unknown
+func (m model) pageSize() int {
+	if m.height == 0 {
+		return 0
+	}
+	// The title, the position, the summary and the help
+	return max(m.height-7, 1)
+}
+
+// View renders the UI each time Update is called.
+func (m model) View() string {
+	if m.done {
+		// Once done, just return. Program will quit, returning to Pick.
+		return ""
+	}
+
+	s := headerStyle.Render("Select the sections and files to download") + "\n\n"
+	if len(m.rows) == 0 {
+		s += "No files were found in the selected courses\n\n(enter or q to continue)"
+		return s
+	}
+
+	start, end := 0, len(m.rows)
+	if page := m.pageSize(); page > 0 {
+		start, end = m.offset, min(m.offset+page, len(m.rows))
+	}
+	for i := start; i < end; i++ {
+		cursor := " "
+		if i == m.cursor {
+			cursor = ">"
+		}
+		s += cursor + " " + m.line(m.rows[i]) + "\n"
+	}
+	if start > 0 || end < len(m.rows) {
+		s += fmt.Sprintf("(%d-%d of %d)\n", start+1, end, len(m.rows))
+	}
+
+	var selected, total int
+	var size int64
+	for _, root := range m.roots {
+		rootSelected, rootTotal, rootSize := root.counts()
+		selected, total, size = selected+rootSelected, total+rootTotal, size+rootSize
+	}
+	s += fmt.Sprintf("\n%d of %d files selected (%s)\n", selected, total, types.FormatBytes(size))
+	s += "\n(↑/↓ or k/j to navigate, →/l to expand, ←/h to collapse, space to toggle, enter to confirm, q to quit)\n(* to select all, 0 to select none)"
+	return s
+}
+
+// line formats a node: its checkbox and name and, for the files, their size, date and whether they are
+// already downloaded, or, for the other nodes, the number of files selected
+func (m model) line(n *node) string {
+	indent := strings.Repeat("  ", n.depth)
+	selected, total, size := n.counts()
+
+	checked := " "
+	switch {
+	case selected == total && total > 0:
+		checked = "x"
+	case selected > 0:
+		checked = "~"
+	}
+
+	if n.file != nil {
+		details := types.FormatBytes(n.file.FileSize)
+		if n.file.TimeModified != 0 {
+			details += "  " + time.Unix(n.file.TimeModified, 0).Format("2006-01-02")
+		}
+		s := fmt.Sprintf("%s  [%s] %s  %s", indent, checked, n.label, detailStyle.Render(details))
+		if n.downloaded {
+			s += "  " + downloadedStyle.Render("✓ downloaded")
+		}
+		return s
+	}
+
+	arrow := "▸"
+	if n.expanded {
+		arrow = "▾"
+	}
+	label := n.label
+	if n.depth == 0 {
+		label = headerStyle.Render(label)
+	}
+	return fmt.Sprintf("%s%s [%s] %s  %s", indent, arrow, checked, label,
+		detailStyle.Render(fmt.Sprintf("(%d/%d files, %s)", selected, total, types.FormatBytes(size))))
+}
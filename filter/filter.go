@@ -0,0 +1,313 @@
+// Package filter decides which files are downloaded using an ordered list of rules.
+// As in rsync, the first rule that matches a file decides whether it is included or excluded,
+// and the files that match no rule are included.
+package filter
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bytesize "github.com/Astrak00/AGDownloader/bytesize"
+)
+
+// Entry is the information of a file the rules are matched against
+type Entry struct {
+	Path     string    // Path relative to the download directory, separated by "/"
+	Size     int64     // Size in bytes, 0 if unknown
+	Modified time.Time // Last modification in AulaGlobal, zero if unknown
+	MimeType string
+}
+
+// Name returns the name of the file, without its directories
+func (e Entry) Name() string {
+	return path.Base(e.Path)
+}
+
+// Rule includes or excludes the files that match its condition
+type Rule struct {
+	Include bool
+	Spec    string // Rule as written by the user, e.g. "- *.mp4"
+	Origin  string // Option the rule comes from, e.g. "--filter"
+	match   func(Entry) bool
+}
+
+// String returns the rule as written by the user
+func (r Rule) String() string {
+	return r.Spec
+}
+
+// Rules is an ordered list of rules
+type Rules struct {
+	rules []Rule
+}
+
+// Add appends a rule, that is only checked if no previous rule matches
+func (r *Rules) Add(rule Rule) {
+	r.rules = append(r.rules, rule)
+}
+
+// Len returns the number of rules
+func (r *Rules) Len() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.rules)
+}
+
+// Match returns whether the file must be downloaded and the position of the rule that decided it,
+// or -1 if no rule matched and the file is included by default
+func (r *Rules) Match(entry Entry) (bool, int) {
+	if r == nil {
+		return true, -1
+	}
+	for i, rule := range r.rules {
+		if rule.match(entry) {
+			return rule.Include, i
+		}
+	}
+	return true, -1
+}
+
+// Describe returns a description of the rule at position i, as returned by Match
+func (r *Rules) Describe(i int) string {
+	if r == nil || i < 0 || i >= len(r.rules) {
+		return "no rule matched, included by default"
+	}
+	rule := r.rules[i]
+	return fmt.Sprintf("rule %d (%s): %s", i+1, rule.Origin, rule.Spec)
+}
+
+// ParseRule parses a rule such as "+ *.pdf", "- Videos/", "- size>100MB", "+ modified>=2024-09-01",
+// "- mime=video/*", "- regex=^Grabación" or "+ ext=pdf,docx"
+func ParseRule(spec string, origin string) (Rule, error) {
+	spec = strings.TrimSpace(spec)
+	sign, condition, found := strings.Cut(spec, " ")
+	condition = strings.TrimSpace(condition)
+	if !found || condition == "" {
+		return Rule{}, fmt.Errorf("invalid rule %q, expected \"+ pattern\" or \"- pattern\"", spec)
+	}
+
+	rule := Rule{Spec: spec, Origin: origin}
+	switch strings.ToLower(sign) {
+	case "+", "include":
+		rule.Include = true
+	case "-", "exclude":
+		rule.Include = false
+	default:
+		return Rule{}, fmt.Errorf("invalid rule %q, it must start with + or -", spec)
+	}
+
+	match, err := parseCondition(condition)
+	if err != nil {
+		return Rule{}, fmt.Errorf("invalid rule %q: %v", spec, err)
+	}
+	rule.match = match
+	return rule, nil
+}
+
+var comparisonRegex = regexp.MustCompile(`^(size|modified)\s*(<=|>=|<|>)\s*(.+)$`)
+
+// parseCondition returns the function that checks the condition of a rule
+func parseCondition(condition string) (func(Entry) bool, error) {
+	if parts := comparisonRegex.FindStringSubmatch(condition); parts != nil {
+		switch parts[1] {
+		case "size":
+			size, err := ParseSize(parts[3])
+			if err != nil {
+				return nil, err
+			}
+			// AulaGlobal doesn't report the size of some files, the limits don't apply to them
+			return func(e Entry) bool { return e.Size > 0 && compare(e.Size, parts[2], size) }, nil
+		case "modified":
+			date, err := ParseDate(parts[3])
+			if err != nil {
+				return nil, err
+			}
+			return func(e Entry) bool {
+				return !e.Modified.IsZero() && compare(e.Modified.Unix(), parts[2], date.Unix())
+			}, nil
+		}
+	}
+
+	if key, value, found := strings.Cut(condition, "="); found {
+		switch key {
+		case "regex":
+			re, err := regexp.Compile(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression: %v", err)
+			}
+			return func(e Entry) bool { return re.MatchString(e.Name()) }, nil
+		case "mime":
+			pattern := strings.ToLower(value)
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid mimetype pattern: %v", err)
+			}
+			return func(e Entry) bool {
+				matched, _ := path.Match(pattern, strings.ToLower(e.MimeType))
+				return matched
+			}, nil
+		case "ext":
+			extensions := make(map[string]struct{})
+			for _, ext := range strings.Split(value, ",") {
+				ext = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(ext)), ".")
+				if ext != "" {
+					extensions[ext] = struct{}{}
+				}
+			}
+			return func(e Entry) bool {
+				_, ok := extensions[strings.TrimPrefix(strings.ToLower(path.Ext(e.Path)), ".")]
+				return ok
+			}, nil
+		}
+	}
+
+	return parseGlob(condition)
+}
+
+// compare applies a comparison operator
+func compare(value int64, operator string, limit int64) bool {
+	switch operator {
+	case "<":
+		return value < limit
+	case "<=":
+		return value <= limit
+	case ">":
+		return value > limit
+	}
+	return value >= limit
+}
+
+// parseGlob follows the rules of rsync: a pattern without "/" is matched against the name of the file,
+// a pattern starting with "/" against the whole path and any other pattern against the end of the path.
+// A pattern ending with "/" matches everything inside the directories it matches.
+// "*" matches anything but "/", "**" matches anything and "?" matches a single character other than "/".
+func parseGlob(pattern string) (func(Entry) bool, error) {
+	anchored := strings.HasPrefix(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+	if pattern == "" {
+		return nil, fmt.Errorf("empty pattern")
+	}
+
+	expression, err := globToRegex(pattern)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case anchored:
+		expression = "^" + expression + "$"
+	case strings.Contains(pattern, "/"):
+		expression = "(^|/)" + expression + "$"
+	default:
+		re, err := regexp.Compile("^" + expression + "$")
+		if err != nil {
+			return nil, err
+		}
+		return func(e Entry) bool { return re.MatchString(e.Name()) }, nil
+	}
+
+	re, err := regexp.Compile(expression)
+	if err != nil {
+		return nil, err
+	}
+	return func(e Entry) bool { return re.MatchString(e.Path) }, nil
+}
+
+// globToRegex translates a glob pattern into a regular expression
+func globToRegex(pattern string) (string, error) {
+	var builder strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				builder.WriteString(".*")
+				i++
+			} else {
+				builder.WriteString("[^/]*")
+			}
+		case '?':
+			builder.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("unclosed [ in %q", pattern)
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			builder.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			// The bytes of the non-ASCII characters are copied one by one, converting them to a rune would change them
+			builder.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	return builder.String(), nil
+}
+
+// ParseSize parses a size such as "500KB", "1.5GiB" or "100M"
+func ParseSize(s string) (int64, error) {
+	value, err := bytesize.Parse(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q, expected a value such as 100MB", s)
+	}
+	return int64(value), nil
+}
+
+// ParseDate parses a date such as "2024-09-01" (local time) or "2024-09-01T10:00:00+02:00"
+func ParseDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if date, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return date, nil
+	}
+	if date, err := time.Parse(time.RFC3339, s); err == nil {
+		return date, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q, expected a date such as 2024-09-01", s)
+}
+
+// Decision is the result of matching the rules against a file
+type Decision struct {
+	Path     string
+	Included bool
+	Reason   string
+}
+
+// Report records the decisions taken for every file, to explain them to the user
+type Report struct {
+	mu        sync.Mutex
+	decisions []Decision
+}
+
+// Record adds a decision to the report. A nil report records nothing.
+func (r *Report) Record(decision Decision) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.decisions = append(r.decisions, decision)
+	r.mu.Unlock()
+}
+
+// Decisions returns the recorded decisions sorted by path
+func (r *Report) Decisions() []Decision {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	decisions := append([]Decision(nil), r.decisions...)
+	r.mu.Unlock()
+
+	sort.Slice(decisions, func(i, j int) bool {
+		return decisions[i].Path < decisions[j].Path
+	})
+	return decisions
+}
@@ -0,0 +1,191 @@
+package filter
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rules parses the specs in order, failing the test if one is invalid
+func rules(t *testing.T, specs ...string) *Rules {
+	t.Helper()
+	r := &Rules{}
+	for _, spec := range specs {
+		rule, err := ParseRule(spec, "test")
+		if err != nil {
+			t.Fatalf("ParseRule(%q): %v", spec, err)
+		}
+		r.Add(rule)
+	}
+	return r
+}
+
+func TestMatchOrder(t *testing.T) {
+	r := rules(t, "+ Apuntes/", "- *.pdf", "+ *.pdf")
+	tests := []struct {
+		path     string
+		included bool
+		rule     int
+	}{
+		{"Cálculo/Apuntes/tema1.pdf", true, 0},
+		{"Cálculo/Exámenes/2023.pdf", false, 1},
+		{"Cálculo/Exámenes/2023.docx", true, -1},
+	}
+	for _, tt := range tests {
+		included, rule := r.Match(Entry{Path: tt.path})
+		if included != tt.included || rule != tt.rule {
+			t.Errorf("Match(%q) = %v, %d, want %v, %d", tt.path, included, rule, tt.included, tt.rule)
+		}
+	}
+
+	if got := r.Describe(1); got != "rule 2 (test): - *.pdf" {
+		t.Errorf("Describe(1) = %q", got)
+	}
+	if got := r.Describe(-1); got != "no rule matched, included by default" {
+		t.Errorf("Describe(-1) = %q", got)
+	}
+
+	// Without rules every file is included
+	var none *Rules
+	if included, rule := none.Match(Entry{Path: "a.pdf"}); !included || rule != -1 {
+		t.Errorf("nil Rules: Match = %v, %d, want true, -1", included, rule)
+	}
+}
+
+func TestGlobs(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*.mp4", "Cálculo/Vídeos/clase.mp4", true},
+		{"*.mp4", "Cálculo/clase.mp4.txt", false},
+		{"clase?.mp4", "Cálculo/clase1.mp4", true},
+		{"clase?.mp4", "Cálculo/clase10.mp4", false},
+		{"clase[!2].mp4", "Cálculo/clase1.mp4", true},
+		{"clase[!2].mp4", "Cálculo/clase2.mp4", false},
+		{"Vídeos/", "Cálculo/Vídeos/clase.mp4", true},
+		{"Vídeos/", "Cálculo/Vídeos/2023/clase.mp4", true},
+		{"Vídeos/", "Cálculo/MisVídeos/clase.mp4", false},
+		{"Vídeos/*.mp4", "Cálculo/Vídeos/clase.mp4", true},
+		{"Vídeos/*.mp4", "Cálculo/Vídeos/2023/clase.mp4", false},
+		{"Vídeos/**.mp4", "Cálculo/Vídeos/2023/clase.mp4", true},
+		{"/Cálculo/Exámenes/**", "Cálculo/Exámenes/2023/final.pdf", true},
+		{"/Exámenes/**", "Cálculo/Exámenes/final.pdf", false},
+		{"*", "Cálculo/a.pdf", true},
+	}
+	for _, tt := range tests {
+		r := rules(t, "- "+tt.pattern)
+		if included, _ := r.Match(Entry{Path: tt.path}); included == tt.want {
+			t.Errorf("pattern %q matched %q = %v, want %v", tt.pattern, tt.path, !included, tt.want)
+		}
+	}
+}
+
+func TestConditions(t *testing.T) {
+	modified := time.Date(2024, time.October, 1, 12, 0, 0, 0, time.Local)
+	entry := Entry{Path: "Cálculo/Grabación 1.MP4", Size: 150 * 1000 * 1000, Modified: modified, MimeType: "video/mp4"}
+	unknown := Entry{Path: "Cálculo/notas.pdf"}
+
+	tests := []struct {
+		spec  string
+		entry Entry
+		want  bool
+	}{
+		{"- size>100MB", entry, true},
+		{"- size>200MB", entry, false},
+		{"- size<=150MB", entry, true},
+		{"- size>=1GiB", entry, false},
+		{"- modified>=2024-09-01", entry, true},
+		{"- modified<2024-09-01", entry, false},
+		{"- modified>2024-10-01T10:00:00Z", entry, true},
+		{"- mime=video/*", entry, true},
+		{"- mime=application/pdf", entry, false},
+		{"- regex=^Grabación", entry, true},
+		{"- regex=^Cálculo", entry, false},
+		{"- ext=pdf,mp4", entry, true},
+		{"- ext=.PDF", entry, false},
+		// The limits don't apply to the files whose size or date is unknown
+		{"- size<1MB", unknown, false},
+		{"- size>=0", unknown, false},
+		{"- modified<2100-01-01", unknown, false},
+	}
+	for _, tt := range tests {
+		r := rules(t, tt.spec)
+		if included, _ := r.Match(tt.entry); included == tt.want {
+			t.Errorf("rule %q matched %q = %v, want %v", tt.spec, tt.entry.Path, !included, tt.want)
+		}
+	}
+}
+
+func TestParseRuleErrors(t *testing.T) {
+	for _, spec := range []string{"", "*.pdf", "+", "? *.pdf", "- size>big", "- modified<yesterday", "- regex=(", "- mime=[", "- [abc", "- /"} {
+		if _, err := ParseRule(spec, "test"); err == nil {
+			t.Errorf("ParseRule(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	r, err := Build(Options{
+		CourseFilters: []string{"- Vídeos/"},
+		Filters:       []string{"+ *.mp4"},
+		Include:       []string{"pdf", " ", "mp4"},
+		Exclude:       []string{"zip"},
+		MaxSize:       "100MB",
+		ModifiedSince: "2024-09-01",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Date(2024, time.October, 1, 0, 0, 0, 0, time.Local)
+	tests := []struct {
+		entry    Entry
+		included bool
+		origin   string
+	}{
+		// The limits are checked before the rules of the user, that can't include the files they exclude
+		{Entry{Path: "a/clase.mp4", Size: 200 * 1000 * 1000, Modified: modified}, false, "--max-size"},
+		{Entry{Path: "a/old.pdf", Size: 1000, Modified: modified.AddDate(-1, 0, 0)}, false, "--modified-since"},
+		{Entry{Path: "a/Vídeos/clase.mp4", Size: 1000, Modified: modified}, false, "course settings"},
+		{Entry{Path: "a/clase.mp4", Size: 1000, Modified: modified}, true, "--filter"},
+		{Entry{Path: "a/code.zip", Size: 1000, Modified: modified}, false, "--exclude"},
+		{Entry{Path: "a/notes.pdf", Size: 1000, Modified: modified}, true, "--include"},
+		{Entry{Path: "a/notes.docx", Size: 1000, Modified: modified}, false, "--include"},
+		// A file whose size is unknown is not excluded by --max-size
+		{Entry{Path: "a/big.pdf", Modified: modified}, true, "--include"},
+	}
+	for _, tt := range tests {
+		included, rule := r.Match(tt.entry)
+		if included != tt.included || !strings.Contains(r.Describe(rule), "("+tt.origin+")") {
+			t.Errorf("Match(%q) = %v, %s, want %v by %s", tt.entry.Path, included, r.Describe(rule), tt.included, tt.origin)
+		}
+	}
+
+	if _, err := Build(Options{MinSize: "a lot"}); err == nil || !strings.HasPrefix(err.Error(), "--min-size") {
+		t.Errorf("Build with an invalid size = %v, want an error of --min-size", err)
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size string
+		want int64
+	}{
+		{"100", 100},
+		{"500KB", 500 * 1000},
+		{"1.5GiB", 3 << 29},
+		{"100M", 100 * 1000 * 1000},
+		{" 2 mib ", 2 << 20},
+	}
+	for _, tt := range tests {
+		if got, err := ParseSize(tt.size); err != nil || got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d", tt.size, got, err, tt.want)
+		}
+	}
+	for _, size := range []string{"", "MB", "-1KB", "10XB"} {
+		if _, err := ParseSize(size); err == nil {
+			t.Errorf("ParseSize(%q) succeeded, want an error", size)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package filter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Options are the command-line options that create rules
+type Options struct {
+	CourseFilters  []string // Rules of the settings of a course, checked before the --filter ones
+	Filters        []string // Rules given with --filter, in order
+	Include        []string // Extensions given with --include
+	Exclude        []string // Extensions given with --exclude
+	MinSize        string
+	MaxSize        string
+	ModifiedSince  string
+	ModifiedBefore string
+}
+
+// Build creates the rules in the order they are checked: the size and date limits first, so no other rule
+// can include a file they exclude, then the rules of the course settings, the --filter rules, the excluded
+// extensions and, if there are included extensions, those extensions followed by a rule that excludes every other file
+func Build(opts Options) (*Rules, error) {
+	rules := &Rules{}
+	add := func(spec string, origin string) error {
+		rule, err := ParseRule(spec, origin)
+		if err != nil {
+			return fmt.Errorf("%s: %v", origin, err)
+		}
+		rules.Add(rule)
+		return nil
+	}
+
+	limits := []struct {
+		value  string
+		spec   string
+		origin string
+	}{
+		{opts.MinSize, "- size<%s", "--min-size"},
+		{opts.MaxSize, "- size>%s", "--max-size"},
+		{opts.ModifiedSince, "- modified<%s", "--modified-since"},
+		{opts.ModifiedBefore, "- modified>=%s", "--modified-before"},
+	}
+	for _, limit := range limits {
+		if limit.value == "" {
+			continue
+		}
+		if err := add(fmt.Sprintf(limit.spec, limit.value), limit.origin); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, spec := range opts.CourseFilters {
+		if err := add(spec, "course settings"); err != nil {
+			return nil, err
+		}
+	}
+	for _, spec := range opts.Filters {
+		if err := add(spec, "--filter"); err != nil {
+			return nil, err
+		}
+	}
+
+	if exclude := extensions(opts.Exclude); exclude != "" {
+		if err := add("- ext="+exclude, "--exclude"); err != nil {
+			return nil, err
+		}
+	}
+	if include := extensions(opts.Include); include != "" {
+		if err := add("+ ext="+include, "--include"); err != nil {
+			return nil, err
+		}
+		if err := add("- *", "--include"); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// extensions joins a list of extensions, ignoring the empty ones
+func extensions(list []string) string {
+	kept := make([]string, 0, len(list))
+	for _, ext := range list {
+		if ext = strings.TrimSpace(ext); ext != "" {
+			kept = append(kept, ext)
+		}
+	}
+	return strings.Join(kept, ",")
+}
@@ -0,0 +1,87 @@
+// Package history records the runs made in a download directory, to show them in the dashboard
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	state "github.com/Astrak00/AGDownloader/state"
+)
+
+// historyFile keeps the runs of the download directory
+const historyFile = "history.json"
+
+// maxRuns is the number of runs kept, the oldest ones are removed
+const maxRuns = 100
+
+// Run is the summary of a sync
+type Run struct {
+	ID        string    `json:"id"`
+	Source    string    `json:"source"` // What started the run, e.g. "cli" or "dashboard"
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Courses   []string  `json:"courses"` // Names of the synced courses
+	Completed int       `json:"completed"`
+	Failed    int       `json:"failed"`
+	Skipped   int       `json:"skipped"`
+	Stopped   bool      `json:"stopped"`
+}
+
+// mu serializes the writes, so the runs of the dashboard never overwrite each other
+var mu sync.Mutex
+
+// Load returns the runs of the download directory, from the oldest to the newest
+func Load(root string) ([]Run, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	return load(root)
+}
+
+func load(root string) ([]Run, error) {
+	data, err := os.ReadFile(state.Path(root, historyFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the history: %v", err)
+	}
+	var runs []Run
+	if err := json.Unmarshal(data, &runs); err != nil {
+		return nil, fmt.Errorf("failed to parse the history: %v", err)
+	}
+	return runs, nil
+}
+
+// Append adds a run to the history of the download directory
+func Append(root string, run Run) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	runs, err := load(root)
+	if err != nil {
+		return err
+	}
+	runs = append(runs, run)
+	if len(runs) > maxRuns {
+		runs = runs[len(runs)-maxRuns:]
+	}
+
+	data, err := json.MarshalIndent(runs, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := state.Path(root, historyFile)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to save the history: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to save the history: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	redact "github.com/Astrak00/AGDownloader/redact"
+)
+
+// Attribute keys shared by every package so that records can be filtered consistently
+const (
+	KeyCourseID   = "course_id"
+	KeyCourseName = "course"
+	KeyFile       = "file"
+	KeyPath       = "path"
+	KeyAttempt    = "attempt"
+	KeyError      = "error"
+)
+
+// Options configures the global logger
+type Options struct {
+	Level  string // debug, info, warn or error
+	Format string // text or json
+	File   string // optional file where the logs are written instead of stderr
+}
+
+// console is where the logs are written when there is no log file
+var console = &heldWriter{out: os.Stderr}
+
+// heldWriter writes to out, or keeps what is written in memory while it is held
+type heldWriter struct {
+	mu     sync.Mutex
+	out    io.Writer
+	held   bool
+	buffer bytes.Buffer
+}
+
+func (w *heldWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.held {
+		return w.buffer.Write(p)
+	}
+	return w.out.Write(p)
+}
+
+// release writes the logs kept in memory and stops holding them
+func (w *heldWriter) release() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.held = false
+	if _, err := w.buffer.WriteTo(w.out); err != nil {
+		w.buffer.Reset()
+	}
+}
+
+// HoldConsole keeps the logs written to the terminal in memory until the returned function is called, so they
+// don't garble a full screen view such as the download progress. The logs written to a file are not held.
+func HoldConsole() (release func()) {
+	console.mu.Lock()
+	console.held = true
+	console.mu.Unlock()
+	return console.release
+}
+
+// ParseLevel converts the name of a level into a slog.Level
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("unknown log level %q (debug, info, warn, error)", level)
+}
+
+// Validate checks that the level and format are known values
+func (o Options) Validate() error {
+	if _, err := ParseLevel(o.Level); err != nil {
+		return err
+	}
+	switch strings.ToLower(o.Format) {
+	case "", "text", "json":
+		return nil
+	}
+	return fmt.Errorf("unknown log format %q (text, json)", o.Format)
+}
+
+// Setup installs the default slog logger described by the options.
+// The returned function closes the log file, if any, and must be called before exiting.
+func Setup(opts Options) (func() error, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	level, _ := ParseLevel(opts.Level)
+
+	var out io.Writer = console
+	closeFn := func() error { return nil }
+	if opts.File != "" {
+		file, err := os.OpenFile(opts.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file: %v", err)
+		}
+		out = file
+		closeFn = file.Close
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+	var handler slog.Handler
+	if strings.ToLower(opts.Format) == "json" {
+		handler = slog.NewJSONHandler(out, handlerOpts)
+	} else {
+		handler = slog.NewTextHandler(out, handlerOpts)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return closeFn, nil
+}
+
+// redactAttr masks the secrets in every message and attribute before it is written
+func redactAttr(_ []string, a slog.Attr) slog.Attr {
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(redact.String(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			a.Value = slog.StringValue(redact.String(err.Error()))
+		} else if str := fmt.Sprint(a.Value.Any()); redact.String(str) != str {
+			a.Value = slog.StringValue(redact.String(str))
+		}
+	}
+	return a
+}
+
+// Fatal logs the message at error level and exits the program, writing the logs held until then
+func Fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	console.release()
+	os.Exit(1)
+}
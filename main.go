@@ -1,17 +1,33 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"syscall"
+	"time"
 
+	config "github.com/Astrak00/AGDownloader/config"
+	coursename "github.com/Astrak00/AGDownloader/coursename"
 	c "github.com/Astrak00/AGDownloader/courses"
+	dedup "github.com/Astrak00/AGDownloader/dedup"
 	download "github.com/Astrak00/AGDownloader/download"
 	errorlog "github.com/Astrak00/AGDownloader/errorlog"
+	export "github.com/Astrak00/AGDownloader/export"
 	"github.com/Astrak00/AGDownloader/files"
+	filetree "github.com/Astrak00/AGDownloader/filetree"
+	filter "github.com/Astrak00/AGDownloader/filter"
+	history "github.com/Astrak00/AGDownloader/history"
+	logging "github.com/Astrak00/AGDownloader/logging"
 	prog_args "github.com/Astrak00/AGDownloader/prog_args"
+	ratelimit "github.com/Astrak00/AGDownloader/ratelimit"
+	redact "github.com/Astrak00/AGDownloader/redact"
 	token "github.com/Astrak00/AGDownloader/token"
 	types "github.com/Astrak00/AGDownloader/types"
 	u "github.com/Astrak00/AGDownloader/user"
@@ -20,113 +36,752 @@ import (
 )
 
 func main() {
-	// Set up global signal handling
+	// Mask the secrets in the panic message if anything goes wrong
+	defer redact.Recover()
+
+	// Set up global signal handling. The first signal stops the listing and the scheduling of new downloads,
+	// letting the ones in progress finish. The second one exits right away.
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
 	go func() {
-		sigChan := make(chan os.Signal, 1)
+		sigChan := make(chan os.Signal, 2)
 		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 		<-sigChan
-		fmt.Println("\nReceived interrupt signal, exiting...")
-		os.Exit(0)
+		slog.Warn("Received interrupt signal, stopping. Press Ctrl-C again to exit right away")
+		stop()
+		<-sigChan
+		slog.Warn("Received second interrupt signal, exiting")
+		os.Exit(130)
 	}()
 
 	// Parse the flags to get the language, user token, the path to save the downloaded files, maxGoroutines and courses list to download
 	arguments := prog_args.ParseCLIArgs()
 
+	// Configure the structured logger used by every package
+	closeLog, err := logging.Setup(logging.Options{Level: arguments.LogLevel, Format: arguments.LogFormat, File: arguments.LogFile})
+	if err != nil {
+		logging.Fatal("Error configuring the logger", logging.KeyError, err)
+	}
+	defer closeLog()
+
+	// Share the request and bandwidth limits between the listing and the downloads
+	if err := ratelimit.Configure(arguments.RateLimit, arguments.BandwidthLimit); err != nil {
+		logging.Fatal("Error configuring the rate limits", logging.KeyError, err)
+	}
+
+	// Read the settings that don't fit in the command line, such as the ones of every course
+	cfg, err := config.Load(arguments.ConfigPath, arguments.ConfigRequired)
+	if err != nil {
+		logging.Fatal("Error reading the configuration", logging.KeyError, err)
+	}
+	courseOptions, err := courseListingOptions(cfg, arguments)
+	if err != nil {
+		logging.Fatal("Invalid course settings", logging.KeyError, err)
+	}
+	exclusions, err := courseExclusions(cfg)
+	if err != nil {
+		logging.Fatal("Invalid course exclusions", logging.KeyError, err)
+	}
+
 	// Attribution of the program creator
 	color.Cyan("Program created by Astrak00 to download files from Aula Global at UC3M\n")
 
-	// In case the user has not provided a token though the cli, we try to obtain it from a file or ask the user for it
-	if arguments.UserToken == "" {
-		arguments.UserToken = token.ObtainToken()
+	// Run the requested command instead of a full sync. The API needs the courses, so it is set up like a sync.
+	serve := len(arguments.Command) > 0 && arguments.Command[0] == "serve"
+	if serve && len(arguments.Command) != 1 {
+		logging.Fatal("Usage: AGDownloader serve [--web-port port]")
+	}
+	if len(arguments.Command) > 0 && !serve {
+		runCommand(ctx, arguments, cfg)
+		return
+	}
+
+	// The dashboard and the API may run without a terminal, so the missing arguments are reported instead of asked for
+	if serve || arguments.Dashboard {
+		checkServerArgs(&arguments)
 	}
 
+	arguments.UserToken = obtainToken(arguments.UserToken)
+
 	// If there are missing arguments, we prompt the user for them
 	if !arguments.CheckAllAsigned() {
 		arguments = prog_args.PromptMissingArgs(arguments)
 	}
 
-	// Create a map like build map[string]struct{} sets of normalized extensions) and then do O(1) lookups per file to check if the extension is in the include or exclude list. This is more efficient than iterating over the slices for each file.
-	// Create a map for included extensions
-	includeMap := make(types.FileIncludeExcludeMap)
-	for _, ext := range arguments.IncludedExtensions {
-		includeMap[ext] = struct{}{}
+	// The filter rules were validated when parsing the arguments
+	filterRules, _ := filter.Build(prog_args.FilterOptions(arguments))
+
+	// Initialize error logger
+	errLogger, closeErrLogger := initErrorLogger(arguments.DirPath, arguments.ErrorLogFormat)
+	defer closeErrLogger()
+
+	// Obtain the courses the user is enrolled in
+	courses := exclusions.Apply(getCourses(ctx, arguments, &coursename.Parser{Aliases: cfg.Aliases}))
+
+	if arguments.Dashboard {
+		runDashboard(ctx, arguments, enabledCourses(courses.Included(), cfg), filterRules, courseOptions, errLogger)
+		return
 	}
-	// Create a map for excluded extensions
-	excludeMap := make(types.FileIncludeExcludeMap)
-	for _, ext := range arguments.ExcludedExtensions {
-		excludeMap[ext] = struct{}{}
+	if serve {
+		runAPI(ctx, arguments, cfg, enabledCourses(courses.Included(), cfg), filterRules, courseOptions, errLogger)
+		return
 	}
 
-	// Initialize error logger
-	errLogger, err := errorlog.New(arguments.DirPath)
-	if err != nil {
-		log.Printf("Warning: Failed to initialize error logger: %v\n", err)
-		log.Println("Continuing without error logging...")
-		errLogger = nil
+	var coursesList []types.Course
+	if arguments.WebUI {
+		coursesList, err = webui.ShowCourseWeb(ctx, courses.Included(), arguments.WebPort)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logging.Fatal("Error running the web interface", logging.KeyError, err)
+		}
 	} else {
-		defer func() {
-			if errLogger != nil {
-				errCount := errLogger.GetErrorCount()
-				if errCount > 0 {
-					color.Yellow("\nTotal errors logged: %d\n", errCount)
-					color.Yellow("Error log saved to: %s\n", errLogger.GetLogFilePath())
+		previous, err := c.LoadSelection(arguments.DirPath)
+		if err != nil {
+			slog.Warn("The courses of the previous run are not selected", logging.KeyError, err)
+		}
+		selectorOptions := c.SelectorOptions{
+			ShowExcluded: arguments.ShowExcluded,
+			Previous:     previous,
+			Stats: func(courseID string) (int, int64, error) {
+				stats, err := files.CourseStats(ctx, arguments.UserToken, courseID)
+				return stats.Files, stats.Size, err
+			},
+		}
+		coursesList, err = c.SelectCoursesInteractive(arguments.Language, arguments.CoursesList, courses, selectorOptions)
+		if err != nil {
+			logging.Fatal("Invalid course selection", logging.KeyError, err)
+		}
+	}
+	if err := c.SaveSelection(arguments.DirPath, coursesList); err != nil {
+		slog.Warn("Failed to save the selected courses", logging.KeyError, err)
+	}
+	// Create an interactive list so the user can select the courses to download
+
+	coursesList = enabledCourses(coursesList, cfg)
+
+	// Nothing has been downloaded yet, so there is nothing to wait for
+	if ctx.Err() != nil {
+		return
+	}
+
+	listingOptions := newListingOptions(arguments, filterRules, courseOptions)
+	if arguments.Explain {
+		explainFilters(ctx, coursesList, arguments.UserToken, listingOptions, errLogger)
+		return
+	}
+
+	syncCourses(ctx, arguments, coursesList, listingOptions, errLogger, nil, "cli")
+}
+
+// newListingOptions builds the options of the listing. Every run needs its own options, as they
+// keep track of the files renamed because of collisions.
+func newListingOptions(arguments types.ProgramArgs, filterRules *filter.Rules, courseOptions map[string]files.CourseOptions) files.Options {
+	collisionPolicy, _ := files.ParseCollisionPolicy(arguments.CollisionPolicy)
+	layout, _ := files.ParseLayout(arguments.Layout)
+	target, _ := files.ParseTarget(arguments.SanitizeTarget)
+	return files.Options{
+		DirPath:    arguments.DirPath,
+		Filter:     filterRules,
+		Collisions: files.NewCollisions(collisionPolicy),
+		Layout:     layout,
+		Target:     target,
+		Courses:    courseOptions,
+	}
+}
+
+// syncCourses downloads the files of the courses once they are listed, or once they are picked with --browse,
+// and adds the run to the history. The runs followed through events, such as the ones of the dashboard,
+// don't show the progress view.
+func syncCourses(ctx context.Context, arguments types.ProgramArgs, coursesList []types.Course, listingOptions files.Options, errLogger *errorlog.ErrorLogger, events func(download.Event), source string) history.Run {
+	run := history.Run{Source: source, Start: time.Now()}
+	run.ID = run.Start.Format("20060102-150405")
+	for _, course := range coursesList {
+		run.Courses = append(run.Courses, course.Name)
+	}
+
+	// Create a channel to stream the files from the listing to the downloads, and another for the errors that may occur when listing the resources.
+	// The files are sent once every course is listed and are downloaded as they arrive, so the channel doesn't need to hold every file.
+	filesStoreChan := make(chan types.FileStore)
+	errChan := make(chan error, len(coursesList))
+
+	// Stopping the run from the progress view stops the listing as well
+	ctx, stopRun := context.WithCancel(ctx)
+	defer stopRun()
+
+	if arguments.Browse {
+		// The whole listing is needed to show the tree, so the downloads start once the files are picked.
+		// Nothing is downloaded nor added to the history if the browser is closed without picking them.
+		picked, ok := pickFiles(ctx, coursesList, arguments.UserToken, listingOptions, errLogger)
+		if !ok {
+			return run
+		}
+		go func() {
+			defer redact.Recover()
+			for _, fileStore := range picked {
+				select {
+				case filesStoreChan <- fileStore:
+				case <-ctx.Done():
 				}
-				errLogger.Close()
 			}
+			close(errChan)
+			close(filesStoreChan)
+		}()
+	} else {
+		// List all the resources to download and send them to the channel while they are being downloaded
+		go func() {
+			defer redact.Recover()
+			files.ListAllResources(ctx, coursesList, arguments.UserToken, listingOptions, errChan, filesStoreChan, errLogger)
+			close(errChan)
+			close(filesStoreChan)
 		}()
-		color.Green("Error logging initialized: %s\n", errLogger.GetLogFilePath())
 	}
 
-	// Obtain the courses the user is enrolled in
+	// Download all the files in the channel
+	dedupIndex := openDedupIndex(arguments.DirPath, arguments.Dedup)
+	opts := downloadOptions(arguments)
+	opts.Dedup = dedupIndex
+	opts.Events = events
+	opts.Quiet = events != nil
+	opts.Stop = stopRun
+	summary := download.DownloadFiles(ctx, filesStoreChan, opts, coursesList, errLogger)
+	closeDedupIndex(dedupIndex)
+
+	for err := range errChan {
+		if err != nil {
+			slog.Error("Error listing resources", logging.KeyError, err)
+		}
+	}
+
+	if renamed := listingOptions.Collisions.Renamed(); len(renamed) > 0 {
+		slog.Warn("Some files were renamed because another file had the same destination", "count", len(renamed))
+		for _, rename := range renamed {
+			slog.Warn("Renamed file", logging.KeyCourseID, rename.CourseID, "from", rename.From, "to", rename.To)
+		}
+	}
+
+	run.End = time.Now()
+	run.Completed, run.Failed, run.Skipped, run.Stopped = summary.Completed, summary.Failed, summary.Skipped, summary.Stopped
+	if err := history.Append(arguments.DirPath, run); err != nil {
+		slog.Warn("Failed to save the run in the history", logging.KeyError, err)
+	}
+	return run
+}
+
+// checkServerArgs exits if the token or the download directory are missing, as they can't be asked for
+// without a terminal, and uses half of the cores if the number of downloads is not set
+func checkServerArgs(arguments *types.ProgramArgs) {
+	var missing []string
+	if arguments.UserToken == "" && !token.HasStoredToken() {
+		missing = append(missing, "--token")
+	}
+	if arguments.DirPath == "" {
+		missing = append(missing, "--dir")
+	}
+	if len(missing) > 0 {
+		logging.Fatal("Missing arguments, the dashboard and the API don't ask for them", "arguments", strings.Join(missing, ", "))
+	}
+	if arguments.MaxGoroutines == 0 {
+		arguments.MaxGoroutines = max(runtime.NumCPU()/2, 1)
+	}
+}
+
+// runDashboard serves the dashboard until the program is interrupted. The courses are synced with the
+// options of the command line, without --browse.
+func runDashboard(ctx context.Context, arguments types.ProgramArgs, courses []types.Course, filterRules *filter.Rules, courseOptions map[string]files.CourseOptions, errLogger *errorlog.ErrorLogger) {
+	arguments.Browse = false
+	err := webui.RunDashboard(ctx, webui.DashboardOptions{
+		Port:    arguments.WebPort,
+		Courses: courses,
+		ListFiles: func(ctx context.Context, course types.Course) ([]types.FileStore, error) {
+			return listFiles(ctx, []types.Course{course}, arguments.UserToken, newListingOptions(arguments, filterRules, courseOptions), errLogger)
+		},
+		Sync: func(ctx context.Context, courses []types.Course, events func(download.Event)) history.Run {
+			return syncCourses(ctx, arguments, courses, newListingOptions(arguments, filterRules, courseOptions), errLogger, events, "dashboard")
+		},
+		History: func() ([]history.Run, error) {
+			return history.Load(arguments.DirPath)
+		},
+	})
+	if err != nil {
+		logging.Fatal("Error running the dashboard", logging.KeyError, err)
+	}
+}
+
+// runAPI serves the JSON API until the program is interrupted. The jobs are synced with the options of the
+// command line, without --browse, and with the filters of the command line unless the job has its own.
+func runAPI(ctx context.Context, arguments types.ProgramArgs, cfg *config.Config, courses []types.Course, filterRules *filter.Rules, courseOptions map[string]files.CourseOptions, errLogger *errorlog.ErrorLogger) {
+	arguments.Browse = false
+	token, err := webui.LoadAPIToken(arguments.DirPath)
+	if err != nil {
+		logging.Fatal("Error obtaining the API token", logging.KeyError, err)
+	}
+	slog.Info("The clients of the API must send the token in the Authorization header", logging.KeyPath, webui.APITokenPath(arguments.DirPath))
+
+	err = webui.RunAPI(ctx, webui.APIOptions{
+		Port:    arguments.WebPort,
+		Token:   token,
+		Courses: courses,
+		ListFiles: func(ctx context.Context, course types.Course) ([]types.FileStore, error) {
+			return listFiles(ctx, []types.Course{course}, arguments.UserToken, newListingOptions(arguments, filterRules, courseOptions), errLogger)
+		},
+		NewSync: func(filters *webui.Filters) (webui.SyncFunc, error) {
+			jobArguments, jobRules, jobCourseOptions := arguments, filterRules, courseOptions
+			if filters != nil {
+				jobArguments.Filters = filters.Filter
+				jobArguments.IncludedExtensions = filters.Include
+				jobArguments.ExcludedExtensions = filters.Exclude
+				jobArguments.MinSize, jobArguments.MaxSize = filters.MinSize, filters.MaxSize
+				jobArguments.ModifiedSince, jobArguments.ModifiedBefore = filters.ModifiedSince, filters.ModifiedBefore
+				var err error
+				if jobRules, err = filter.Build(prog_args.FilterOptions(jobArguments)); err != nil {
+					return nil, err
+				}
+				if jobCourseOptions, err = courseListingOptions(cfg, jobArguments); err != nil {
+					return nil, err
+				}
+			}
+			return func(ctx context.Context, courses []types.Course, events func(download.Event)) history.Run {
+				return syncCourses(ctx, jobArguments, courses, newListingOptions(jobArguments, jobRules, jobCourseOptions), errLogger, events, "api")
+			}, nil
+		},
+	})
+	if err != nil {
+		logging.Fatal("Error running the API", logging.KeyError, err)
+	}
+}
+
+// initErrorLogger creates the error log in dirPath, or returns nil if it can't be created.
+// The returned function reports the number of errors and closes the log.
+func initErrorLogger(dirPath string, format string) (*errorlog.ErrorLogger, func()) {
+	logFormat, _ := errorlog.ParseFormat(format)
+	errLogger, err := errorlog.New(dirPath, logFormat)
+	if err != nil {
+		slog.Warn("Failed to initialize error logger, continuing without error logging", logging.KeyError, err)
+		return nil, func() {}
+	}
+	slog.Info("Error logging initialized", logging.KeyPath, errLogger.GetLogFilePath())
+
+	return errLogger, func() {
+		errCount := errLogger.GetErrorCount()
+		if errCount > 0 {
+			slog.Warn("Errors were logged during the run", "count", errCount, logging.KeyPath, errLogger.GetLogFilePath())
+			if jsonPath := errLogger.GetJSONLogFilePath(); jsonPath != "" {
+				slog.Info("The failed downloads can be retried", "command", "AGDownloader retry-failed "+jsonPath)
+			}
+		}
+		errLogger.Close()
+	}
+}
+
+// runCommand runs one of the commands that replace the full sync
+func runCommand(ctx context.Context, arguments types.ProgramArgs, cfg *config.Config) {
+	switch arguments.Command[0] {
+	case "courses":
+		if len(arguments.Command) != 2 || arguments.Command[1] != "names" {
+			logging.Fatal("Usage: AGDownloader courses names [--explain]")
+		}
+		arguments.UserToken = obtainToken(arguments.UserToken)
+		showCourseNames(ctx, arguments, cfg)
+	case "retry-failed":
+		if len(arguments.Command) != 2 {
+			logging.Fatal("Usage: AGDownloader retry-failed <error log .jsonl file>")
+		}
+		arguments.UserToken = obtainToken(arguments.UserToken)
+		retryFailed(ctx, arguments, arguments.Command[1])
+	case "dedup":
+		if len(arguments.Command) > 2 {
+			logging.Fatal("Usage: AGDownloader dedup [download directory]")
+		}
+		dirPath := arguments.DirPath
+		if len(arguments.Command) == 2 {
+			dirPath = arguments.Command[1]
+		}
+		if dirPath == "" {
+			dirPath = "."
+		}
+		deduplicate(dirPath, arguments.Dedup)
+	case "export":
+		if len(arguments.Command) < 2 || len(arguments.Command) > 3 {
+			logging.Fatal("Usage: AGDownloader export <course> [archive .zip or .tar.gz] [--stream]")
+		}
+		archivePath := ""
+		if len(arguments.Command) == 3 {
+			archivePath = arguments.Command[2]
+			if _, err := export.ParseFormat(archivePath); err != nil {
+				logging.Fatal("Invalid archive", logging.KeyError, err)
+			}
+		}
+		arguments.UserToken = obtainToken(arguments.UserToken)
+		exportCourse(ctx, arguments, cfg, arguments.Command[1], archivePath)
+	default:
+		logging.Fatal("Unknown command", "command", arguments.Command[0])
+	}
+}
+
+// getCourses obtains the courses the user is enrolled in, naming them with the parser, and keeps the ones of the --year and --semester
+func getCourses(ctx context.Context, arguments types.ProgramArgs, names *coursename.Parser) types.Courses {
 	var courses types.Courses
+	var err error
 	if arguments.Timeline {
-		// Use timeline API to get all courses (current, past, and future if available)
-		courses, err = c.GetCoursesByTimeline(arguments.UserToken, arguments.Language)
+		// Use timeline API to get the courses of the classification (all, in progress, past...)
+		courses, err = c.GetCoursesByTimeline(arguments.UserToken, arguments.Classification, arguments.Language, names)
 	} else {
 		// Obtain the user information by logging in with the token
-		user, err := u.GetUserInfo(arguments.UserToken)
+		user, err := u.GetUserInfo(ctx, arguments.UserToken)
 		retriesCounter := 0
 		for err != nil && retriesCounter < 3 {
-			user, err = u.GetUserInfo(arguments.UserToken)
+			user, err = u.GetUserInfo(ctx, arguments.UserToken)
 			retriesCounter++
-			log.Default().Printf("Error getting user info: %v\nTrying again. Attempt %d/3", err, retriesCounter)
+			slog.Warn("Error getting user info, trying again", logging.KeyAttempt, retriesCounter, logging.KeyError, err)
 			if retriesCounter == 3 {
-				log.Fatalf("Error getting user info after 3 attempts")
+				logging.Fatal("Error getting user info after 3 attempts")
 			}
 		}
 
 		// Use standard API with userID
-		courses, err = c.GetCourses(arguments.UserToken, user.UserID, arguments.Language)
+		courses, err = c.GetCourses(arguments.UserToken, user.UserID, arguments.Language, names)
 	}
 	if err != nil {
-		log.Fatalf("Error getting courses: %v\n", err)
+		logging.Fatal("Error getting courses", logging.KeyError, err)
 	}
 
-	var coursesList []types.Course
-	if arguments.WebUI {
-		coursesList = webui.ShowCourseWeb(courses)
-	} else {
-		coursesList = c.SelectCoursesInteractive(arguments.Language, arguments.CoursesList, courses)
+	// The year and semester were validated when the arguments were parsed
+	year, _ := c.ParseYear(arguments.Year)
+	semester, _ := c.ParseSemester(arguments.Semester)
+	return c.Term{Year: year, Semester: semester}.Filter(courses)
+}
+
+// showCourseNames prints the name of every course and, with --explain, how it was derived from AulaGlobal's names
+func showCourseNames(ctx context.Context, arguments types.ProgramArgs, cfg *config.Config) {
+	// The exclusions were validated when the configuration was read
+	exclusions, _ := courseExclusions(cfg)
+	courses := exclusions.Apply(getCourses(ctx, arguments, &coursename.Parser{Aliases: cfg.Aliases}))
+	if arguments.Explain {
+		fmt.Println("Known name formats, in the order they are checked:")
+		for _, description := range coursename.Patterns() {
+			fmt.Printf("  %s\n", description)
+		}
+		fmt.Println()
 	}
-	// Create an interactive list so the user can select the courses to download
+	for _, course := range courses {
+		if course.Excluded != "" {
+			color.HiBlack("%s  %s (excluded by %q)", course.ID, course.Name, course.Excluded)
+		} else {
+			color.Green("%s  %s", course.ID, course.Name)
+		}
+		if arguments.Explain {
+			fmt.Printf("    from %q\n    %s\n", course.FullName, course.NameSource)
+		}
+	}
+}
 
-	// Create a channel to store the files and another for the errors that may occur when listing all the resources to download
-	filesStoreChan := make(chan types.FileStore, len(courses)*100)
-	errChan := make(chan error, len(courses))
+// retryFailed downloads again only the files that failed in a previous run, as recorded in its JSON Lines error log
+func retryFailed(ctx context.Context, arguments types.ProgramArgs, logPath string) {
+	records, err := errorlog.ReadRecords(logPath)
+	if err != nil {
+		logging.Fatal("Error reading the error log", logging.KeyPath, logPath, logging.KeyError, err)
+	}
 
-	// List all the resources to downloaded and send them to the channel
-	files.ListAllResources(coursesList, arguments.UserToken, arguments.DirPath, &includeMap, &excludeMap, errChan, filesStoreChan, errLogger)
+	fileStores := files.FileStoresFromRecords(records, arguments.UserToken)
+	if len(fileStores) == 0 {
+		slog.Info("There are no failed downloads to retry", logging.KeyPath, logPath)
+		return
+	}
+	slog.Info("Retrying failed downloads", "count", len(fileStores), logging.KeyPath, logPath)
+
+	// The error logs are stored in <dir>/error_logs, so the new one is written next to the previous one
+	dirPath := arguments.DirPath
+	if dirPath == "" {
+		dirPath = filepath.Dir(filepath.Dir(logPath))
+	}
+	if arguments.MaxGoroutines == 0 {
+		arguments.MaxGoroutines = max(runtime.NumCPU()/2, 1)
+	}
+
+	errLogger, closeErrLogger := initErrorLogger(dirPath, arguments.ErrorLogFormat)
+	defer closeErrLogger()
 
-	close(errChan)
+	filesStoreChan := make(chan types.FileStore, len(fileStores))
+	for _, fileStore := range fileStores {
+		filesStoreChan <- fileStore
+	}
 	close(filesStoreChan)
 
+	dedupIndex := openDedupIndex(dirPath, arguments.Dedup)
+	opts := downloadOptions(arguments)
+	opts.Dedup = dedupIndex
+	opts.Root = dirPath
+	download.DownloadFiles(ctx, filesStoreChan, opts, nil, errLogger)
+	closeDedupIndex(dedupIndex)
+}
+
+// exportCourse packages the files of the course in an archive, read from the download directory or, with
+// --stream, downloaded from AulaGlobal. The archive is named after the course if archivePath is empty.
+func exportCourse(ctx context.Context, arguments types.ProgramArgs, cfg *config.Config, selector string, archivePath string) {
+	if arguments.DirPath == "" {
+		arguments.DirPath = "."
+	}
+	// The exclusions, filters and course settings were validated when the arguments and the configuration were read
+	exclusions, _ := courseExclusions(cfg)
+	filterRules, _ := filter.Build(prog_args.FilterOptions(arguments))
+	courseOptions, _ := courseListingOptions(cfg, arguments)
+
+	courses := exclusions.Apply(getCourses(ctx, arguments, &coursename.Parser{Aliases: cfg.Aliases}))
+	matched, err := c.Match(courses, []string{selector})
+	if err != nil {
+		logging.Fatal("Invalid course", logging.KeyError, err)
+	}
+	course := matched[0]
+
+	// The archives are usually opened in other computers, so the names are valid in every file system by default
+	target := files.TargetPortable
+	if arguments.SanitizeTarget != "" {
+		target, _ = files.ParseTarget(arguments.SanitizeTarget)
+	}
+	if archivePath == "" {
+		archivePath = target.Component(course.Name) + ".zip"
+	}
+
+	listed, err := listFiles(ctx, []types.Course{course}, arguments.UserToken, newListingOptions(arguments, filterRules, courseOptions), nil)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil && len(listed) == 0 {
+		logging.Fatal("Error listing the files of the course", logging.KeyCourseID, course.ID, logging.KeyError, err)
+	}
+
+	slog.Info("Exporting the course", "course", course.Name, "files", len(listed), logging.KeyPath, archivePath, "stream", arguments.Stream)
+	summary, err := export.Course(ctx, archivePath, course, listed, export.Options{Stream: arguments.Stream, Target: target})
+	if ctx.Err() != nil {
+		slog.Warn("The export was stopped, the archive was not created")
+		return
+	}
+	if err != nil {
+		logging.Fatal("Error exporting the course", logging.KeyError, err)
+	}
+	slog.Info("Course exported", logging.KeyPath, archivePath, "exported", summary.Exported, "missing", summary.Missing, "failed", summary.Failed)
+	if summary.Missing > 0 {
+		slog.Warn("Some files are not synced, sync the course or export it with --stream to include them", "count", summary.Missing)
+	}
+}
+
+// courseListingOptions validates the settings of every course in the configuration and converts them
+// to listing options. The filters of a course are combined with the global ones.
+func courseListingOptions(cfg *config.Config, arguments types.ProgramArgs) (map[string]files.CourseOptions, error) {
+	courseOptions := make(map[string]files.CourseOptions, len(cfg.Courses))
+	for id, settings := range cfg.Courses {
+		options := files.CourseOptions{Dir: settings.Dir}
+
+		if settings.Layout != "" {
+			layout, err := files.ParseLayout(settings.Layout)
+			if err != nil {
+				return nil, fmt.Errorf("course %s: %v", id, err)
+			}
+			options.Layout = layout
+		}
+
+		filterOptions := prog_args.FilterOptions(arguments)
+		filterOptions.CourseFilters = settings.Filters
+		replaced := len(settings.Filters) > 0
+		for _, field := range []struct {
+			value  []string
+			target *[]string
+		}{
+			{settings.Include, &filterOptions.Include},
+			{settings.Exclude, &filterOptions.Exclude},
+		} {
+			if len(field.value) > 0 {
+				*field.target = field.value
+				replaced = true
+			}
+		}
+		for _, field := range []struct {
+			value  string
+			target *string
+		}{
+			{settings.MinSize, &filterOptions.MinSize},
+			{settings.MaxSize, &filterOptions.MaxSize},
+			{settings.ModifiedSince, &filterOptions.ModifiedSince},
+			{settings.ModifiedBefore, &filterOptions.ModifiedBefore},
+		} {
+			if field.value != "" {
+				*field.target = field.value
+				replaced = true
+			}
+		}
+		if replaced {
+			rules, err := filter.Build(filterOptions)
+			if err != nil {
+				return nil, fmt.Errorf("course %s: %v", id, err)
+			}
+			options.Filter = rules
+		}
+
+		if len(settings.Modules) > 0 {
+			options.Modules = make(map[string]struct{}, len(settings.Modules))
+			for _, module := range settings.Modules {
+				options.Modules[module] = struct{}{}
+			}
+		}
+		courseOptions[id] = options
+	}
+	return courseOptions, nil
+}
+
+// courseExclusions returns the rules that hide courses from the selection, the default ones
+// unless the configuration has its own list
+func courseExclusions(cfg *config.Config) (*c.Exclusions, error) {
+	if cfg.ExcludeCourses == nil {
+		return c.ParseExclusions(c.DefaultExclusions)
+	}
+	return c.ParseExclusions(cfg.ExcludeCourses)
+}
+
+// enabledCourses removes the courses that are disabled in the configuration
+func enabledCourses(coursesList []types.Course, cfg *config.Config) []types.Course {
+	enabled := make([]types.Course, 0, len(coursesList))
+	for _, course := range coursesList {
+		if !cfg.Course(course.ID).IsEnabled() {
+			slog.Info("Skipping course disabled in the configuration", logging.KeyCourseID, course.ID, logging.KeyCourseName, course.Name)
+			continue
+		}
+		enabled = append(enabled, course)
+	}
+	return enabled
+}
+
+// explainFilters lists the files of the courses without downloading them, showing the rule that included
+// or excluded every file
+func explainFilters(ctx context.Context, coursesList []types.Course, userToken string, listingOptions files.Options, errLogger *errorlog.ErrorLogger) {
+	listingOptions.Explain = &filter.Report{}
+	// Nothing is downloaded, the files are only listed to record the decisions
+	listFiles(ctx, coursesList, userToken, listingOptions, errLogger)
+
+	included := 0
+	decisions := listingOptions.Explain.Decisions()
+	for _, decision := range decisions {
+		if decision.Included {
+			included++
+			color.Green("+ %s", decision.Path)
+		} else {
+			color.Red("- %s", decision.Path)
+		}
+		fmt.Printf("    %s\n", decision.Reason)
+	}
+	fmt.Printf("%d of %d files would be downloaded\n", included, len(decisions))
+}
+
+// listFiles lists every file of the courses, reporting the errors of the listing
+func listFiles(ctx context.Context, coursesList []types.Course, userToken string, listingOptions files.Options, errLogger *errorlog.ErrorLogger) ([]types.FileStore, error) {
+	filesStoreChan := make(chan types.FileStore)
+	errChan := make(chan error, len(coursesList))
+	go func() {
+		defer redact.Recover()
+		files.ListAllResources(ctx, coursesList, userToken, listingOptions, errChan, filesStoreChan, errLogger)
+		close(errChan)
+		close(filesStoreChan)
+	}()
+
+	var listed []types.FileStore
+	for fileStore := range filesStoreChan {
+		listed = append(listed, fileStore)
+	}
+	var errs []error
 	for err := range errChan {
 		if err != nil {
-			fmt.Println("Error:", err)
+			slog.Error("Error listing resources", logging.KeyError, err)
+			errs = append(errs, err)
 		}
 	}
+	return listed, errors.Join(errs...)
+}
 
-	// Download all the files in the channel
-	download.DownloadFiles(filesStoreChan, arguments.MaxGoroutines, coursesList, errLogger)
+// pickFiles lists the files of the courses and lets the user pick the ones to download in a tree.
+// It returns false if the browser was closed without picking the files.
+func pickFiles(ctx context.Context, coursesList []types.Course, userToken string, listingOptions files.Options, errLogger *errorlog.ErrorLogger) ([]types.FileStore, bool) {
+	// The errors of the listing were reported, the files of the other courses can still be picked
+	listed, _ := listFiles(ctx, coursesList, userToken, listingOptions, errLogger)
+	if ctx.Err() != nil {
+		return nil, true
+	}
+	picked, ok, err := filetree.Pick(coursesList, listed)
+	if err != nil {
+		logging.Fatal("Error running the file browser", logging.KeyError, err)
+	}
+	if !ok {
+		slog.Info("The file browser was closed, nothing is downloaded")
+		return nil, false
+	}
+	slog.Info("Files picked", "count", len(picked), "listed", len(listed))
+	return picked, true
+}
+
+// downloadOptions builds the options of the downloads from the program arguments
+func downloadOptions(arguments types.ProgramArgs) download.Options {
+	schedule, _ := download.ParseSchedule(arguments.Schedule)
+	return download.Options{
+		MaxGoroutines:  arguments.MaxGoroutines,
+		Schedule:       schedule,
+		PerCourseLimit: arguments.PerCourseLimit,
+		Root:           arguments.DirPath,
+		DirTimes:       arguments.DirTimes,
+	}
+}
+
+// obtainToken returns the token given through the cli or, if there is none, obtains it from a file or asks the user for it.
+// The token is registered so it never appears in the logs, the error log or any other output.
+func obtainToken(userToken string) string {
+	if userToken == "" {
+		userToken = token.ObtainToken()
+	}
+	redact.Register(userToken)
+	return userToken
+}
 
+// openDedupIndex opens the deduplication index of the download directory, or returns nil if deduplication is disabled
+func openDedupIndex(dirPath string, method string) *dedup.Index {
+	if method == "" {
+		return nil
+	}
+	dedupMethod, _ := dedup.ParseMethod(method)
+	dedupIndex, err := dedup.Open(dirPath, dedupMethod)
+	if err != nil {
+		slog.Warn("Failed to open the dedup index, continuing without deduplication", logging.KeyError, err)
+		return nil
+	}
+	return dedupIndex
+}
+
+// closeDedupIndex saves the deduplication index and reports the space saved
+func closeDedupIndex(dedupIndex *dedup.Index) {
+	if dedupIndex == nil {
+		return
+	}
+	if err := dedupIndex.Save(); err != nil {
+		slog.Warn("Failed to save the dedup index", logging.KeyError, err)
+	}
+	stats := dedupIndex.Stats()
+	slog.Info("Deduplication finished",
+		"files", stats.Files,
+		"duplicates", stats.Duplicates,
+		"kept_as_copies", stats.Copies,
+		"space_saved", types.FormatBytes(stats.SpaceSaved))
+}
+
+// deduplicate indexes the files already in the download directory, replacing the duplicates with links
+func deduplicate(dirPath string, method string) {
+	if method == "" {
+		method = string(dedup.MethodAuto)
+	}
+	dedupIndex := openDedupIndex(dirPath, method)
+	if dedupIndex == nil {
+		os.Exit(1)
+	}
+	slog.Info("Deduplicating the files", logging.KeyPath, dirPath)
+	if err := dedupIndex.Scan(); err != nil {
+		slog.Error("Error scanning the download directory", logging.KeyPath, dirPath, logging.KeyError, err)
+	}
+	closeDedupIndex(dedupIndex)
 }
@@ -2,11 +2,21 @@ package prog_args
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"regexp"
 	"strconv"
+	"strings"
 
+	config "github.com/Astrak00/AGDownloader/config"
+	c "github.com/Astrak00/AGDownloader/courses"
+	dedup "github.com/Astrak00/AGDownloader/dedup"
+	download "github.com/Astrak00/AGDownloader/download"
+	errorlog "github.com/Astrak00/AGDownloader/errorlog"
+	files "github.com/Astrak00/AGDownloader/files"
+	filter "github.com/Astrak00/AGDownloader/filter"
+	logging "github.com/Astrak00/AGDownloader/logging"
+	ratelimit "github.com/Astrak00/AGDownloader/ratelimit"
 	types "github.com/Astrak00/AGDownloader/types"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/spf13/pflag"
@@ -34,7 +44,76 @@ It defines and processes the following flags:
 
 --fast: If set, MaxGoroutines will be set to the number of files for fastest downloading.
 
---courses: A list of course IDs or names to be downloaded, enclosed in quotes and separated by spaces. "all" downloads all courses.
+--courses: A list of course IDs, short names or names to be downloaded, separated by commas. "all" downloads all courses.
+A name matches the courses whose name contains it, ignoring the case and the accents. Entries that match no course
+or several courses are reported as errors.
+
+--courses-file: File with the courses to be downloaded, one per line, as in --courses. Lines starting with # are ignored.
+
+--log-level: Minimum level of the log messages: debug, info, warn or error. Default is "info".
+
+--log-format: Format of the log messages: text or json. Default is "text".
+
+--log-file: File where the log messages are written instead of stderr.
+
+--error-log-format: Format of the error log: text, jsonl or both. Default is "both".
+
+--rate: Maximum number of requests per second to AulaGlobal, shared by the listing and the downloads (e.g. "5/s").
+
+--bwlimit: Maximum download bandwidth shared by all the downloads (e.g. "2MB/s").
+Both limits accept time windows, e.g. "2MB/s,08:00-20:00=500KB/s,01:00-07:00=off".
+
+--schedule: Order in which the files are downloaded: fifo, smallest-first, newest-first, round-robin,
+or round-robin combined with an order, e.g. "round-robin,newest-first". Default is "fifo".
+
+--per-course: Maximum number of simultaneous downloads of the same course. Default is 0 (unlimited).
+
+--collisions: How files with the same destination are renamed: module (adds the module name) or numeric
+(adds a number). Default is "module".
+
+--layout: Template of the path of every file, e.g. "{year}/{course_short}/{section_num:02} {section}/{filename}".
+Default is "{course}/{section}/{filename}".
+
+--filter: Rule to include (+) or exclude (-) files, can be repeated. The first matching rule decides.
+Rules match a glob on the path ("- Videos/"), a size ("- size>100MB"), a date ("- modified<2024-09-01"),
+a mimetype ("- mime=video/*"), a regular expression on the name ("- regex=^Grabación") or extensions ("+ ext=pdf").
+
+--min-size, --max-size: Do not download files smaller or larger than the size.
+
+--modified-since, --modified-before: Only download files modified in that range of dates.
+
+--config: Configuration file with the settings of every course. Default is "agdownloader.json".
+
+--classification: Fetch the courses of a timeline classification: all, inprogress, past, future, favourites,
+hidden or allincludinghidden. "--timeline" is the same as "--classification all".
+
+--year, --semester: Only show the courses of an academic year (e.g. "2024/25") and semester (1 or 2).
+
+--show-excluded: Show the courses hidden by the exclusion list, greyed out, in the course selector.
+
+--web-port: Port of the web interface, the dashboard and the API of "serve", that only listen on 127.0.0.1.
+Default is a free port, or 8765 for the API.
+
+--dashboard: Open a local web dashboard, instead of downloading right away, to search the courses, see their files,
+sync them and follow the progress and the history of the runs. It runs until Ctrl-C is pressed.
+
+--browse: List the files of the selected courses first and pick the sections, modules and files to download
+in a tree. The files that are already downloaded start unselected.
+
+--stream: With the export command, download the files from AulaGlobal straight into the archive, instead of
+reading the synced ones, so no loose files are kept on disk.
+
+--explain: List the files without downloading them, showing the rule that decided each one.
+
+--dir-times: If set, the directories get the modification time of their newest file.
+
+--sanitize: File system the file names are made valid for: posix, windows, macos or portable.
+Default is the one of the operating system.
+
+--dedup: Replace the downloaded files whose content was already downloaded with links: auto (reflink if
+available, otherwise hardlink), reflink or hardlink. "--dedup" alone uses auto. Disabled by default.
+
+The remaining positional arguments are returned as the command to run, e.g. "retry-failed <logfile>".
 It validates the token and adjusts the number of cores if the fast flag is set.
 
 Returns a ProgramArgs struct containing the parsed values.
@@ -46,11 +125,41 @@ func ParseCLIArgs() types.ProgramArgs {
 	cores := pflag.Int("p", 0, "Number of cores to be used while downloading")
 	fast := pflag.Bool("fast", false, "Set MaxGoroutines to the number of files for fastest downloading")
 	webUI := pflag.Bool("web", false, "Select the courses using the web interface")
+	webPort := pflag.Int("web-port", 0, "Port of the web interface, the dashboard and the API, only reachable from this computer (default: a free port, 8765 for the API)")
 	timeline := pflag.Bool("timeline", false, "Fetch all courses (current, past, and future) using timeline classification API")
+	classification := pflag.String("classification", "", "Fetch the courses of a timeline classification: "+strings.Join(c.Classifications, ", "))
+	year := pflag.String("year", "", "Only show the courses of an academic year (e.g., 2024/25)")
+	semester := pflag.String("semester", "", "Only show the courses of a semester: 1 or 2")
 	include := pflag.StringSlice("include", []string{}, "Only download files with these extensions (e.g., pdf,pptx). Separate the extensions with commas")
 	exclude := pflag.StringSlice("exclude", []string{}, "Do not download files with these extensions (e.g., mkv,mp4). Separate the extensions with commas")
+	filters := pflag.StringArray("filter", []string{}, "Rule to include (+) or exclude (-) files, e.g. \"- Videos/\" or \"+ size<10MB\". Can be repeated, the first matching rule wins")
+	minSize := pflag.String("min-size", "", "Do not download files smaller than this size (e.g., 10KB)")
+	maxSize := pflag.String("max-size", "", "Do not download files larger than this size (e.g., 100MB)")
+	modifiedSince := pflag.String("modified-since", "", "Only download files modified on or after this date (e.g., 2024-09-01)")
+	modifiedBefore := pflag.String("modified-before", "", "Only download files modified before this date (e.g., 2025-02-01)")
+	dashboard := pflag.Bool("dashboard", false, "Open a local web dashboard to browse, sync and follow the courses")
+	browse := pflag.Bool("browse", false, "Pick the sections and files to download in a tree before downloading")
+	stream := pflag.Bool("stream", false, "With export, download the files from AulaGlobal into the archive instead of reading the synced ones")
+	showExcluded := pflag.Bool("show-excluded", false, "Show the excluded courses, greyed out, in the course selector")
+	configPath := pflag.String("config", config.DefaultPath, "Configuration file with the settings of every course")
+	explain := pflag.Bool("explain", false, "List the files without downloading them, showing the rule that included or excluded each one")
+	logLevel := pflag.String("log-level", "info", "Minimum level of the log messages: debug, info, warn or error")
+	logFormat := pflag.String("log-format", "text", "Format of the log messages: text or json")
+	logFile := pflag.String("log-file", "", "Write the log messages to this file instead of stderr")
+	errorLogFormat := pflag.String("error-log-format", "both", "Format of the error log: text, jsonl (needed by retry-failed) or both")
+	rate := pflag.String("rate", "", "Maximum requests per second to AulaGlobal (e.g. 5/s). Accepts time windows: 5/s,01:00-07:00=off")
+	bwlimit := pflag.String("bwlimit", "", "Maximum download bandwidth (e.g. 2MB/s). Accepts time windows: 2MB/s,08:00-20:00=500KB/s")
+	schedule := pflag.String("schedule", "fifo", "Order of the downloads: fifo, smallest-first, newest-first, round-robin or round-robin,<order>")
+	perCourse := pflag.Int("per-course", 0, "Maximum simultaneous downloads of the same course (0 is unlimited)")
+	dedupMethod := pflag.String("dedup", "", "Replace duplicated files with links: auto, reflink or hardlink (--dedup alone uses auto)")
+	pflag.Lookup("dedup").NoOptDefVal = string(dedup.MethodAuto)
+	collisions := pflag.String("collisions", "module", "Rename files with the same destination adding the module name (module) or a number (numeric)")
+	dirTimes := pflag.Bool("dir-times", false, "Set the modification time of the directories to the one of their newest file")
+	sanitize := pflag.String("sanitize", "", "File system the names are made valid for: posix, windows, macos or portable (default: the one of the operating system)")
+	layout := pflag.String("layout", files.DefaultLayout, "Template of the path of every file, e.g. \"{year}/{course_short}/{section_num:02} {section}/{filename}\"")
 	var courses []string
-	pflag.StringSliceVar(&courses, "courses", []string{}, "Ids or names of the courses to be downloaded, enclosed in \", separated by spaces. \n\"all\" downloads all courses")
+	pflag.StringSliceVar(&courses, "courses", []string{}, "IDs, short names or names of the courses to be downloaded, separated by commas. \n\"all\" downloads all courses")
+	coursesFile := pflag.String("courses-file", "", "File with the courses to be downloaded, one ID, short name or name per line")
 
 	pflag.Parse()
 
@@ -64,24 +173,139 @@ func ParseCLIArgs() types.ProgramArgs {
 
 	if *token != "" {
 		if err := tokenValidator(*token); err != nil {
-			log.Fatalf("Error getting courses: %v\n", err)
+			logging.Fatal("Invalid token", logging.KeyError, err)
 		}
 	}
 
+	if _, err := errorlog.ParseFormat(*errorLogFormat); err != nil {
+		logging.Fatal("Invalid error log format", logging.KeyError, err)
+	}
+
+	if _, err := ratelimit.ParseRate(*rate); err != nil {
+		logging.Fatal("Invalid request rate", logging.KeyError, err)
+	}
+	if _, err := ratelimit.ParseBandwidth(*bwlimit); err != nil {
+		logging.Fatal("Invalid bandwidth limit", logging.KeyError, err)
+	}
+
+	if _, err := download.ParseSchedule(*schedule); err != nil {
+		logging.Fatal("Invalid schedule", logging.KeyError, err)
+	}
+
+	if *dedupMethod != "" {
+		if _, err := dedup.ParseMethod(*dedupMethod); err != nil {
+			logging.Fatal("Invalid dedup method", logging.KeyError, err)
+		}
+	}
+
+	if _, err := files.ParseCollisionPolicy(*collisions); err != nil {
+		logging.Fatal("Invalid collision policy", logging.KeyError, err)
+	}
+
+	if _, err := files.ParseLayout(*layout); err != nil {
+		logging.Fatal("Invalid layout", logging.KeyError, err)
+	}
+
+	if _, err := files.ParseTarget(*sanitize); err != nil {
+		logging.Fatal("Invalid sanitization target", logging.KeyError, err)
+	}
+
+	if *coursesFile != "" {
+		selectors, err := c.ReadSelectors(*coursesFile)
+		if err != nil {
+			logging.Fatal("Invalid courses file", logging.KeyError, err)
+		}
+		courses = append(courses, selectors...)
+	}
+
+	if *webPort < 0 || *webPort > 65535 {
+		logging.Fatal("Invalid web port", logging.KeyError, fmt.Errorf("%d is not a port number", *webPort))
+	}
+
+	// --timeline is the same as --classification all
+	if *classification == "" && *timeline {
+		*classification = "all"
+	}
+	if *classification != "" {
+		if err := c.ParseClassification(*classification); err != nil {
+			logging.Fatal("Invalid classification", logging.KeyError, err)
+		}
+	}
+	if _, err := c.ParseYear(*year); err != nil {
+		logging.Fatal("Invalid year", logging.KeyError, err)
+	}
+	if _, err := c.ParseSemester(*semester); err != nil {
+		logging.Fatal("Invalid semester", logging.KeyError, err)
+	}
+
+	logOptions := logging.Options{Level: *logLevel, Format: *logFormat, File: *logFile}
+	if err := logOptions.Validate(); err != nil {
+		logging.Fatal("Invalid logging options", logging.KeyError, err)
+	}
+
 	if *fast {
 		*cores = -1
 	}
 
-	return types.ProgramArgs{
+	arguments := types.ProgramArgs{
 		Language:           language,
 		UserToken:          *token,
 		DirPath:            *dir,
 		MaxGoroutines:      *cores,
 		CoursesList:        courses,
 		WebUI:              *webUI,
-		Timeline:           *timeline,
+		WebPort:            *webPort,
+		Timeline:           *classification != "",
+		Classification:     *classification,
+		Year:               *year,
+		Semester:           *semester,
 		IncludedExtensions: *include,
 		ExcludedExtensions: *exclude,
+		LogLevel:           *logLevel,
+		LogFormat:          *logFormat,
+		LogFile:            *logFile,
+		ErrorLogFormat:     *errorLogFormat,
+		RateLimit:          *rate,
+		BandwidthLimit:     *bwlimit,
+		Schedule:           *schedule,
+		PerCourseLimit:     *perCourse,
+		Dedup:              *dedupMethod,
+		CollisionPolicy:    *collisions,
+		Layout:             *layout,
+		SanitizeTarget:     *sanitize,
+		DirTimes:           *dirTimes,
+		Command:            pflag.Args(),
+		Filters:            *filters,
+		MinSize:            *minSize,
+		MaxSize:            *maxSize,
+		ModifiedSince:      *modifiedSince,
+		ModifiedBefore:     *modifiedBefore,
+		Explain:            *explain,
+		ConfigPath:         *configPath,
+		ConfigRequired:     pflag.CommandLine.Changed("config"),
+		ShowExcluded:       *showExcluded,
+		Browse:             *browse,
+		Dashboard:          *dashboard,
+		Stream:             *stream,
+	}
+
+	if _, err := filter.Build(FilterOptions(arguments)); err != nil {
+		logging.Fatal("Invalid filter", logging.KeyError, err)
+	}
+
+	return arguments
+}
+
+// FilterOptions returns the options that create the filter rules
+func FilterOptions(arguments types.ProgramArgs) filter.Options {
+	return filter.Options{
+		Filters:        arguments.Filters,
+		Include:        arguments.IncludedExtensions,
+		Exclude:        arguments.ExcludedExtensions,
+		MinSize:        arguments.MinSize,
+		MaxSize:        arguments.MaxSize,
+		ModifiedSince:  arguments.ModifiedSince,
+		ModifiedBefore: arguments.ModifiedBefore,
 	}
 }
 
@@ -94,7 +318,7 @@ func PromptMissingArgs(arguments types.ProgramArgs) types.ProgramArgs {
 
 	finalModel, err := p.Run()
 	if err != nil {
-		log.Fatal(err)
+		logging.Fatal("Error running the arguments prompt", logging.KeyError, err)
 	}
 
 	if finalModel.(model).cancelled {
@@ -109,19 +333,11 @@ func PromptMissingArgs(arguments types.ProgramArgs) types.ProgramArgs {
 	coresInput := finalModel.(model).inputs[corIota].Value()
 	coresObtained, err := strconv.Atoi(coresInput)
 	if err != nil {
-		log.Default().Printf("Error converting cores input to integer: %v. Using 1 core instead", err)
+		slog.Warn("Error converting cores input to integer, using 1 core instead", logging.KeyError, err)
 		coresObtained = 1
 	}
 
-	return types.ProgramArgs{
-		Language:           arguments.Language,
-		UserToken:          arguments.UserToken,
-		DirPath:            dirObtained,
-		MaxGoroutines:      coresObtained,
-		CoursesList:        arguments.CoursesList,
-		WebUI:              arguments.WebUI,
-		Timeline:           arguments.Timeline,
-		IncludedExtensions: arguments.IncludedExtensions,
-		ExcludedExtensions: arguments.ExcludedExtensions,
-	}
+	arguments.DirPath = dirObtained
+	arguments.MaxGoroutines = coresObtained
+	return arguments
 }
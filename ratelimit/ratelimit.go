@@ -0,0 +1,132 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// Shared limiters used by every request to AulaGlobal. A nil limiter does not limit anything.
+var (
+	// Requests limits the number of API and download requests per second
+	Requests *Limiter
+	// Bandwidth limits the number of downloaded bytes per second
+	Bandwidth *Limiter
+)
+
+// Configure sets the shared limiters from the --rate and --bwlimit values
+func Configure(rate string, bandwidth string) error {
+	requestsSchedule, err := ParseRate(rate)
+	if err != nil {
+		return err
+	}
+	bandwidthSchedule, err := ParseBandwidth(bandwidth)
+	if err != nil {
+		return err
+	}
+	Requests = New(requestsSchedule)
+	Bandwidth = New(bandwidthSchedule)
+	return nil
+}
+
+// Limiter is a token bucket whose rate may change with the time of the day.
+// The bucket holds at most one second worth of tokens.
+type Limiter struct {
+	mu       sync.Mutex
+	schedule Schedule
+	tokens   float64
+	last     time.Time
+}
+
+// New creates a limiter following the schedule, or nil if the schedule never limits
+func New(schedule Schedule) *Limiter {
+	if schedule.Unlimited() {
+		return nil
+	}
+	return &Limiter{schedule: schedule}
+}
+
+// Wait blocks until a request can be made
+func (l *Limiter) Wait(ctx context.Context) error {
+	return l.WaitN(ctx, 1)
+}
+
+// WaitN blocks until n tokens are available, or the context is cancelled
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+
+	// The rate may be fractional, so the tokens are counted as floats
+	remaining := float64(n)
+	for remaining > 0 {
+		l.mu.Lock()
+		now := time.Now()
+		rate := l.schedule.At(now)
+		if rate <= 0 {
+			// Unlimited at this time of the day
+			l.mu.Unlock()
+			return nil
+		}
+
+		burst := max(rate, 1)
+		if l.last.IsZero() {
+			l.tokens = burst
+		} else {
+			l.tokens = min(burst, l.tokens+now.Sub(l.last).Seconds()*rate)
+		}
+		l.last = now
+
+		// Reserve the tokens, the bucket may go negative and the caller waits until it is refilled
+		take := min(remaining, burst)
+		l.tokens -= take
+		remaining -= take
+		var wait time.Duration
+		if l.tokens < 0 {
+			wait = time.Duration(-l.tokens / rate * float64(time.Second))
+		}
+		l.mu.Unlock()
+
+		if wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
+		}
+	}
+	return nil
+}
+
+// Reader returns a reader that consumes one token per byte read from r
+func (l *Limiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &limitedReader{ctx: ctx, reader: r, limiter: l}
+}
+
+type limitedReader struct {
+	ctx     context.Context
+	reader  io.Reader
+	limiter *Limiter
+}
+
+// maxChunk keeps the bursts small, so the bandwidth is shared evenly between the downloads
+const maxChunk = 32 * 1024
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > maxChunk {
+		p = p[:maxChunk]
+	}
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.WaitN(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,170 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	bytesize "github.com/Astrak00/AGDownloader/bytesize"
+)
+
+// Schedule is a rate, in units per second, that can be different depending on the time of the day.
+// A rate of 0 means unlimited.
+type Schedule struct {
+	Default float64
+	Windows []Window
+}
+
+// Window applies a rate between two times of the day. If From is after To, the window wraps around midnight.
+type Window struct {
+	From time.Duration // Since midnight
+	To   time.Duration // Since midnight
+	Rate float64
+}
+
+// At returns the rate that applies at the given time
+func (s Schedule) At(t time.Time) float64 {
+	sinceMidnight := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	for _, w := range s.Windows {
+		if w.contains(sinceMidnight) {
+			return w.Rate
+		}
+	}
+	return s.Default
+}
+
+// Unlimited reports whether the schedule never limits
+func (s Schedule) Unlimited() bool {
+	if s.Default > 0 {
+		return false
+	}
+	for _, w := range s.Windows {
+		if w.Rate > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (w Window) contains(d time.Duration) bool {
+	if w.From <= w.To {
+		return d >= w.From && d < w.To
+	}
+	return d >= w.From || d < w.To
+}
+
+// ParseRate parses a request rate such as "5/s", "120/m" or "1000/h".
+// A plain number is a rate per second and "off" means unlimited.
+// See parseSchedule for the time-of-day syntax.
+func ParseRate(s string) (Schedule, error) {
+	return parseSchedule(s, parseRateValue)
+}
+
+// ParseBandwidth parses a bandwidth such as "2MB/s", "500KB/s" or "1.5M".
+// A plain number is in bytes per second and "off" means unlimited.
+// See parseSchedule for the time-of-day syntax.
+func ParseBandwidth(s string) (Schedule, error) {
+	return parseSchedule(s, parseBandwidthValue)
+}
+
+// parseSchedule parses a comma separated list of rates. A rate prefixed by a time window, as in
+// "08:00-23:00=1MB/s", only applies during that window; the rate without a window applies the rest of the day.
+// Example: "2MB/s,08:00-20:00=500KB/s,01:00-07:00=off"
+func parseSchedule(s string, parseValue func(string) (float64, error)) (Schedule, error) {
+	var schedule Schedule
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return schedule, nil
+	}
+
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		window, value, hasWindow := strings.Cut(item, "=")
+		if !hasWindow {
+			rate, err := parseValue(item)
+			if err != nil {
+				return schedule, err
+			}
+			schedule.Default = rate
+			continue
+		}
+
+		fromStr, toStr, ok := strings.Cut(window, "-")
+		if !ok {
+			return schedule, fmt.Errorf("invalid time window %q, expected HH:MM-HH:MM", window)
+		}
+		from, err := parseTimeOfDay(fromStr)
+		if err != nil {
+			return schedule, err
+		}
+		to, err := parseTimeOfDay(toStr)
+		if err != nil {
+			return schedule, err
+		}
+		rate, err := parseValue(value)
+		if err != nil {
+			return schedule, err
+		}
+		schedule.Windows = append(schedule.Windows, Window{From: from, To: to, Rate: rate})
+	}
+	return schedule, nil
+}
+
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of the day %q, expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func isUnlimited(s string) bool {
+	switch strings.ToLower(s) {
+	case "off", "unlimited", "none", "0":
+		return true
+	}
+	return false
+}
+
+func parseRateValue(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if isUnlimited(s) {
+		return 0, nil
+	}
+
+	number, unit, _ := strings.Cut(s, "/")
+	perSecond := 1.0
+	switch strings.ToLower(unit) {
+	case "", "s", "sec":
+	case "m", "min":
+		perSecond = 1.0 / 60
+	case "h", "hour":
+		perSecond = 1.0 / 3600
+	default:
+		return 0, fmt.Errorf("invalid rate unit %q in %q, expected /s, /m or /h", unit, s)
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid rate %q", s)
+	}
+	return value * perSecond, nil
+}
+
+func parseBandwidthValue(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if isUnlimited(s) {
+		return 0, nil
+	}
+
+	// Bit rates such as 16Mbps would be read as bytes, 8 times the intended rate
+	if lower := strings.ToLower(s); strings.HasSuffix(s, "bps") || strings.HasSuffix(lower, "bit/s") || strings.HasSuffix(lower, "bits") {
+		return 0, fmt.Errorf("invalid bandwidth %q, bit rates are not accepted, use bytes per second such as 2MB/s", s)
+	}
+	value, err := bytesize.Parse(strings.TrimSuffix(strings.TrimSuffix(s, "/s"), "ps"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid bandwidth %q, expected a value such as 2MB/s", s)
+	}
+	return value, nil
+}
@@ -0,0 +1,80 @@
+package redact
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Mask is the text that replaces every secret
+const Mask = "[REDACTED]"
+
+// minSecretLength avoids masking short, common strings by accident
+const minSecretLength = 8
+
+var (
+	mu      sync.RWMutex
+	secrets []string
+
+	// Query parameters and cookies that always carry credentials, even if the value was never registered
+	credentialPattern = regexp.MustCompile(`(?i)((?:ws)?token=|MoodleSession[a-z]*=)[^&\s"';<>)]+`)
+)
+
+// Register adds a secret (the wstoken, the MoodleSession cookie...) that must never be shown
+func Register(secret string) {
+	secret = strings.TrimSpace(secret)
+	if len(secret) < minSecretLength {
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, s := range secrets {
+		if s == secret {
+			return
+		}
+	}
+	secrets = append(secrets, secret)
+	// Replace the longest secrets first, so a secret containing another one is fully masked
+	sort.Slice(secrets, func(i, j int) bool { return len(secrets[i]) > len(secrets[j]) })
+}
+
+// String masks the registered secrets and any credential found in query strings or cookies
+func String(s string) string {
+	mu.RLock()
+	for _, secret := range secrets {
+		s = strings.ReplaceAll(s, secret, Mask)
+	}
+	mu.RUnlock()
+	return credentialPattern.ReplaceAllString(s, "${1}"+Mask)
+}
+
+// redactedError keeps the original error for errors.Is and errors.As, but hides the secrets in its message
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// Error returns an error whose message has the secrets masked
+func Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &redactedError{msg: String(err.Error()), err: err}
+}
+
+// Recover must be deferred at the start of a goroutine. If the goroutine panics,
+// the panic value and the stack trace are printed with the secrets masked and the program exits.
+func Recover() {
+	if r := recover(); r != nil {
+		fmt.Fprintf(os.Stderr, "panic: %s\n\n%s", String(fmt.Sprint(r)), String(string(debug.Stack())))
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,13 @@
+// Package state locates the files the program keeps between runs in the download directory
+package state
+
+import "path/filepath"
+
+// Dir is the directory, inside the download directory, where the files kept between runs are stored,
+// such as the dedup index or the courses selected in the last run
+const Dir = ".agdownloader"
+
+// Path returns the path of a file kept between runs in the download directory
+func Path(root string, name string) string {
+	return filepath.Join(root, Dir, name)
+}
@@ -1,11 +1,12 @@
 package token
 
 import (
-	"fmt"
-	"log"
+	"log/slog"
 	"os"
 
 	"github.com/Astrak00/AGDownloader/cookies"
+	logging "github.com/Astrak00/AGDownloader/logging"
+	redact "github.com/Astrak00/AGDownloader/redact"
 	"github.com/Astrak00/AGDownloader/types"
 	webui "github.com/Astrak00/AGDownloader/webUI"
 )
@@ -19,25 +20,34 @@ func ObtainToken() string {
 	if _, err := os.Stat(types.TokenDir); err == nil {
 		data, err := os.ReadFile(types.TokenDir)
 		if err != nil {
-			log.Fatalf("Error reading file%v: %v\n", types.TokenDir, err)
+			logging.Fatal("Error reading the token file", logging.KeyPath, types.TokenDir, logging.KeyError, err)
 		}
 		//fmt.Println("Token token loaded from", types.TokenDir)
+		redact.Register(string(data))
 		return string(data)
 	}
 
 	// get token from cookie using web popup
-	fmt.Println("Opening browser to obtain cookie...")
+	slog.Info("Opening browser to obtain cookie")
 	cookie := webui.AskForCookieWeb()
 	if cookie == "" {
 		cookie = cookies.AskForCookie()
 	}
+	redact.Register(cookie)
 	token := cookies.CookieToToken(cookie)
+	redact.Register(token)
 
 	saveToken(token)
 
 	return token
 }
 
+// HasStoredToken reports whether a previous run saved the token, so it can be obtained without asking for it
+func HasStoredToken() bool {
+	_, err := os.Stat(types.TokenDir)
+	return err == nil
+}
+
 // saveToken saves the token to a file names types.TokenDir (aulaglobal-token)
 func saveToken(token string) {
 	if token == "" {
@@ -47,7 +57,7 @@ func saveToken(token string) {
 	// We save the token to a file to be able to read it in future executions
 	err := os.WriteFile(types.TokenDir, []byte(token), 0644)
 	if err != nil {
-		log.Fatal("Error saving the token to a file", err)
+		logging.Fatal("Error saving the token to a file", logging.KeyPath, types.TokenDir, logging.KeyError, err)
 	}
-	fmt.Println("Token saved to", types.TokenDir)
+	slog.Info("Token saved", logging.KeyPath, types.TokenDir)
 }
@@ -1,5 +1,10 @@
 package types
 
+import (
+	"fmt"
+	"time"
+)
+
 const (
 	Domain     = "aulaglobal.uc3m.es"
 	Webservice = "/webservice/rest/server.php"
@@ -14,9 +19,39 @@ type ProgramArgs struct {
 	MaxGoroutines      int
 	CoursesList        []string
 	WebUI              bool
+	WebPort            int // Port of the web interface and the dashboard, 0 picks a free one
 	Timeline           bool
+	Classification     string // Timeline classification, e.g. "inprogress", empty to use the user's course list
+	Year               string
+	Semester           string
 	IncludedExtensions []string
 	ExcludedExtensions []string
+	LogLevel           string
+	LogFormat          string
+	LogFile            string
+	ErrorLogFormat     string
+	RateLimit          string
+	BandwidthLimit     string
+	Schedule           string
+	PerCourseLimit     int
+	Dedup              string
+	CollisionPolicy    string
+	Layout             string
+	SanitizeTarget     string
+	DirTimes           bool
+	Filters            []string
+	MinSize            string
+	MaxSize            string
+	ModifiedSince      string
+	ModifiedBefore     string
+	Explain            bool
+	ConfigPath         string
+	ConfigRequired     bool // The configuration file was given with --config, so it must exist
+	ShowExcluded       bool
+	Browse             bool
+	Dashboard          bool
+	Stream             bool // The export command downloads the files into the archive instead of reading the synced ones
+	Command            []string
 }
 
 // Check if all the arguments are assigned
@@ -28,18 +63,67 @@ func (p ProgramArgs) CheckAllAsigned() bool {
 }
 
 type File struct {
-	FileName string
-	FileURL  string
+	FileName     string
+	FileURL      string
+	FileSize     int64
+	TimeModified int64  // Unix time of the last modification in AulaGlobal
+	ModuleName   string // Name of the module (resource, folder...) that contains the file
+	ModuleType   string // Type of the module: resource, folder, assign...
+	SectionName  string // Name of the section, empty for the general section
+	SectionNum   int    // Position of the section in the course
+	BaseName     string // Name of the file, without the section
+	MimeType     string
 }
 
 type Course struct {
-	Name string
-	ID   string
+	Name      string
+	ID        string
+	ShortName string
+	FullName  string
+	Category  string
+	StartDate int64 // Unix time, 0 if unknown
+	EndDate   int64 // Unix time, 0 if unknown
+	// NameSource explains how the name was derived from the names in AulaGlobal
+	NameSource string
+	// Excluded is the exclusion rule that hides the course, empty if it is not excluded
+	Excluded  string
+	Hidden    bool // Hidden by the user in the AulaGlobal dashboard
+	Favourite bool // Starred by the user in the AulaGlobal dashboard
+}
+
+// AcademicYear returns the year the academic year of the course starts in, e.g. 2024 for 2024/25, and
+// the semester, 1 or 2, from its start date. Academic years start in July, so a course starting in
+// February 2025 belongs to the second semester of 2024/25. Both are 0 if the start date is unknown.
+func (c Course) AcademicYear() (int, int) {
+	if c.StartDate <= 0 {
+		return 0, 0
+	}
+	start := time.Unix(c.StartDate, 0)
+	if start.Month() < time.July {
+		return start.Year() - 1, 2
+	}
+	return start.Year(), 1
+}
+
+// FormatAcademicYear formats the year an academic year starts in, e.g. 2024/25, using the separator
+func FormatAcademicYear(year int, separator string) string {
+	return fmt.Sprintf("%d%s%02d", year, separator, (year+1)%100)
 }
 
 // Define a named type for a slice of Course
 type Courses []Course
 
+// Included returns the courses that are not excluded
+func (c Courses) Included() Courses {
+	included := make(Courses, 0, len(c))
+	for _, course := range c {
+		if course.Excluded == "" {
+			included = append(included, course)
+		}
+	}
+	return included
+}
+
 // Map the courses to obtain a []string with the names of the courses
 func (c Courses) GetCoursesName() []string {
 	coursesNames := make([]string, len(c))
@@ -50,14 +134,31 @@ func (c Courses) GetCoursesName() []string {
 }
 
 type FileStore struct {
-	FileName string
-	FileURL  string
-	Dir      string
+	FileName     string
+	FileURL      string
+	Dir          string
+	FileSize     int64 // Size reported by AulaGlobal, 0 if unknown
+	TimeModified int64 // Unix time of the last modification in AulaGlobal, 0 if unknown
+	CourseID     string
+	SectionName  string // Section and module of the course the file belongs to, empty if unknown
+	ModuleName   string
+}
+
+// FormatBytes formats a size in bytes using binary units
+func FormatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
 }
 
 type UserInfo struct {
 	FullName string
 	UserID   string
 }
-
-type FileIncludeExcludeMap map[string]struct{}
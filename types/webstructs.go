@@ -1,9 +1,12 @@
 package types
 
 import (
+	"context"
 	"io"
-	"log"
 	"net/http"
+
+	logging "github.com/Astrak00/AGDownloader/logging"
+	ratelimit "github.com/Astrak00/AGDownloader/ratelimit"
 )
 
 type WebCourse []struct {
@@ -121,18 +124,34 @@ type TimelineCourses struct {
 	} `json:"courses"`
 }
 
+// GetJson obtains the json from the URL, exiting the program if it can't be retrieved
 func GetJson(URL string) []byte {
+	jsonData, err := GetJsonContext(context.Background(), URL)
+	if err != nil {
+		logging.Fatal("Error requesting the AulaGlobal API", logging.KeyError, err)
+	}
+	return jsonData
+}
+
+// GetJsonContext obtains the json from the URL, the request is aborted if the context is cancelled
+func GetJsonContext(ctx context.Context, URL string) ([]byte, error) {
+	// Respect the shared request rate
+	if err := ratelimit.Requests.Wait(ctx); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, URL, nil)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get the json from the URL
-	resp, err := http.Get(URL)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	// Read the json
-	jsonData, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Fatal(err)
-	}
-	return jsonData
+	return io.ReadAll(resp.Body)
 }
@@ -1,24 +1,32 @@
 package user
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
 	"regexp"
 	"strings"
 
+	ratelimit "github.com/Astrak00/AGDownloader/ratelimit"
 	types "github.com/Astrak00/AGDownloader/types"
-
-	"github.com/fatih/color"
 )
 
 /*
 Gets the userID necessary to get the courses
 TODO: Change this to a json response
 */
-func GetUserInfo(token string) (types.UserInfo, error) {
+func GetUserInfo(ctx context.Context, token string) (types.UserInfo, error) {
 	url := fmt.Sprintf("https://%s%s?wstoken=%s&wsfunction=core_webservice_get_site_info", types.Domain, types.Webservice, token)
-	resp, err := http.Get(url)
+	if err := ratelimit.Requests.Wait(ctx); err != nil {
+		return types.UserInfo{}, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return types.UserInfo{}, err
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return types.UserInfo{}, err
 	}
@@ -41,7 +49,7 @@ func GetUserInfo(token string) (types.UserInfo, error) {
 	if len(maches) >= 1 {
 		userInfo.FullName = maches[1]
 	} else {
-		color.Red("Fullname not found\n")
+		slog.Warn("Fullname not found in the site info")
 	}
 
 	// Find the userid key and value
@@ -50,7 +58,7 @@ func GetUserInfo(token string) (types.UserInfo, error) {
 	if len(maches) > 1 {
 		userInfo.UserID = maches[1]
 	} else {
-		color.Red("UserID not found\n")
+		slog.Warn("UserID not found in the site info")
 	}
 
 	return userInfo, nil
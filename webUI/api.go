@@ -0,0 +1,415 @@
+package webui
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	c "github.com/Astrak00/AGDownloader/courses"
+	download "github.com/Astrak00/AGDownloader/download"
+	history "github.com/Astrak00/AGDownloader/history"
+	logging "github.com/Astrak00/AGDownloader/logging"
+	redact "github.com/Astrak00/AGDownloader/redact"
+	state "github.com/Astrak00/AGDownloader/state"
+	"github.com/Astrak00/AGDownloader/types"
+)
+
+// DefaultAPIPort is the port of the API when --web-port is not given, so the scripts can rely on it
+const DefaultAPIPort = 8765
+
+// apiTokenFile is readable only by the user
+const apiTokenFile = "api-token"
+
+// maxJobs is the number of jobs kept in memory, the oldest finished ones are removed
+const maxJobs = 100
+
+// maxQueuedJobs is the number of jobs that can wait for the one in progress
+const maxQueuedJobs = 16
+
+// Job states
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobFinished  = "finished"
+	JobStopped   = "stopped"   // The program was interrupted while the job was running
+	JobCancelled = "cancelled" // The program was interrupted before the job started
+)
+
+// Filters of a sync requested through the API, with the meaning of the flags of the same name
+type Filters struct {
+	Filter         []string `json:"filter"`
+	Include        []string `json:"include"`
+	Exclude        []string `json:"exclude"`
+	MinSize        string   `json:"min_size"`
+	MaxSize        string   `json:"max_size"`
+	ModifiedSince  string   `json:"modified_since"`
+	ModifiedBefore string   `json:"modified_before"`
+}
+
+// SyncFunc downloads the files of the courses, reporting every file to events, and returns the summary of the run
+type SyncFunc func(ctx context.Context, courses []types.Course, events func(download.Event)) history.Run
+
+// APIOptions connects the API to the listing and the downloads
+type APIOptions struct {
+	Port      int    // Port of the server, DefaultAPIPort if it is 0
+	Token     string // Token the clients send in the Authorization header
+	Courses   []types.Course
+	ListFiles func(ctx context.Context, course types.Course) ([]types.FileStore, error)
+	// NewSync validates the filters of a job and returns the sync that applies them.
+	// The filters are nil when the job uses the ones of the command line.
+	NewSync func(filters *Filters) (SyncFunc, error)
+}
+
+// jobJSON is the progress of a job
+type jobJSON struct {
+	ID         string       `json:"id"`
+	Status     string       `json:"status"`
+	Courses    []string     `json:"courses"` // IDs of the synced courses
+	Created    time.Time    `json:"created"`
+	Started    *time.Time   `json:"started,omitempty"`
+	Finished   *time.Time   `json:"finished,omitempty"`
+	Queued     int          `json:"queued"`
+	Downloaded int          `json:"downloaded"`
+	Failed     int          `json:"failed"`
+	Skipped    int          `json:"skipped"`
+	Bytes      int64        `json:"bytes"` // Size of the downloaded files
+	Run        *history.Run `json:"run,omitempty"`
+}
+
+type job struct {
+	jobJSON
+	courses []types.Course
+	sync    SyncFunc
+	errors  []download.Event
+}
+
+type apiServer struct {
+	opts  APIOptions
+	ctx   context.Context
+	addr  string
+	queue chan *job
+
+	mu   sync.Mutex
+	jobs []*job // From the oldest to the newest
+}
+
+// LoadAPIToken returns the token of the API of the download directory, creating it the first time
+func LoadAPIToken(root string) (string, error) {
+	path := state.Path(root, apiTokenFile)
+	data, err := os.ReadFile(path)
+	if err == nil && strings.TrimSpace(string(data)) != "" {
+		return strings.TrimSpace(string(data)), nil
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("error reading the API token: %v", err)
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("error creating the API token: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(token+"\n"), 0o600); err != nil {
+		return "", fmt.Errorf("error creating the API token: %v", err)
+	}
+	return token, nil
+}
+
+// APITokenPath is the file where LoadAPIToken keeps the token of the download directory
+func APITokenPath(root string) string {
+	return state.Path(root, apiTokenFile)
+}
+
+// RunAPI serves the JSON API until the context is cancelled, and waits for the job in progress to stop.
+// The syncs are run as jobs, one at a time in the order they were requested.
+func RunAPI(ctx context.Context, opts APIOptions) error {
+	if opts.Token == "" {
+		return errors.New("the API needs a token")
+	}
+	port := opts.Port
+	if port == 0 {
+		port = DefaultAPIPort
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return fmt.Errorf("error starting the API server: %v", err)
+	}
+	a := &apiServer{opts: opts, ctx: ctx, addr: listener.Addr().String(), queue: make(chan *job, maxQueuedJobs)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /courses", a.handleCourses)
+	mux.HandleFunc("GET /courses/{id}/files", a.handleFiles)
+	mux.HandleFunc("POST /sync", a.handleSync)
+	mux.HandleFunc("GET /jobs", a.handleJobs)
+	mux.HandleFunc("GET /jobs/{id}", a.handleJob)
+	mux.HandleFunc("GET /jobs/{id}/errors", a.handleJobErrors)
+
+	server := &http.Server{Handler: a.protect(mux)}
+	slog.Info("API running, press Ctrl-C to stop it", "url", "http://"+a.addr)
+
+	worked := make(chan struct{})
+	go func() {
+		defer redact.Recover()
+		defer close(worked)
+		a.work()
+	}()
+
+	stopped := make(chan struct{})
+	go func() {
+		defer redact.Recover()
+		defer close(stopped)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Warn("Error stopping the API server", logging.KeyError, err)
+		}
+	}()
+
+	if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	<-stopped
+	<-worked
+	return nil
+}
+
+// protect rejects the requests to another host name, that may come from a DNS rebinding attack, and the
+// requests without the token in the Authorization header. Browsers can't send the header to another
+// site without a CORS preflight, which the API doesn't allow.
+func (a *apiServer) protect(next http.Handler) http.Handler {
+	hosts := localHosts(a.addr)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !slices.Contains(hosts, r.Host) {
+			writeError(w, http.StatusForbidden, "forbidden")
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || !equalTokens(token, a.opts.Token) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *apiServer) handleCourses(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, coursesJSON(a.opts.Courses))
+}
+
+func (a *apiServer) handleFiles(w http.ResponseWriter, r *http.Request) {
+	course, ok := findCourse(a.opts.Courses, r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown course")
+		return
+	}
+	listed, err := a.opts.ListFiles(r.Context(), course)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, redact.Error(err).Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, fileTree(listed))
+}
+
+// apiSyncRequest is the body of POST /sync
+type apiSyncRequest struct {
+	// Courses are matched like --courses, by ID, short name or name. Every course is synced if it is empty.
+	Courses []string `json:"courses"`
+	Filters *Filters `json:"filters"` // The filters of the command line are used if it is missing
+}
+
+func (a *apiServer) handleSync(w http.ResponseWriter, r *http.Request) {
+	var request apiSyncRequest
+	if r.ContentLength != 0 {
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&request); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request: %v", err))
+			return
+		}
+	}
+
+	courses := types.Courses(a.opts.Courses)
+	if len(request.Courses) > 0 {
+		var err error
+		courses, err = c.Match(courses, request.Courses)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if len(courses) == 0 {
+		writeError(w, http.StatusBadRequest, "no course selected")
+		return
+	}
+	syncFunc, err := a.opts.NewSync(request.Filters)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := randomToken()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	j := &job{
+		jobJSON: jobJSON{ID: id[:16], Status: JobQueued, Created: time.Now()},
+		courses: courses,
+		sync:    syncFunc,
+		errors:  []download.Event{},
+	}
+	for _, course := range courses {
+		j.Courses = append(j.Courses, course.ID)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.ctx.Err() != nil {
+		writeError(w, http.StatusServiceUnavailable, "the server is stopping")
+		return
+	}
+	select {
+	case a.queue <- j:
+	default:
+		writeError(w, http.StatusServiceUnavailable, "too many jobs are waiting")
+		return
+	}
+	a.add(j)
+	w.Header().Set("Location", "/jobs/"+j.ID)
+	writeJSON(w, http.StatusAccepted, j.jobJSON)
+}
+
+// add keeps the job, removing the oldest finished ones above maxJobs. It must be called with the lock held.
+func (a *apiServer) add(j *job) {
+	a.jobs = append(a.jobs, j)
+	for i := 0; len(a.jobs) > maxJobs && i < len(a.jobs); {
+		if status := a.jobs[i].Status; status == JobQueued || status == JobRunning {
+			i++
+			continue
+		}
+		a.jobs = slices.Delete(a.jobs, i, i+1)
+	}
+}
+
+// work runs the queued jobs one at a time until the context is cancelled
+func (a *apiServer) work() {
+	for {
+		select {
+		case j := <-a.queue:
+			a.run(j)
+		case <-a.ctx.Done():
+			// The handlers no longer queue jobs once the context is cancelled
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			for {
+				select {
+				case j := <-a.queue:
+					now := time.Now()
+					j.Status, j.Finished = JobCancelled, &now
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (a *apiServer) run(j *job) {
+	a.mu.Lock()
+	started := time.Now()
+	j.Status, j.Started = JobRunning, &started
+	a.mu.Unlock()
+
+	run := j.sync(a.ctx, j.courses, func(event download.Event) {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		switch event.Type {
+		case download.EventQueued:
+			j.Queued++
+		case download.EventDownloaded:
+			j.Downloaded++
+			j.Bytes += event.Size
+		case download.EventFailed:
+			j.Failed++
+			j.errors = append(j.errors, event)
+		case download.EventSkipped:
+			j.Skipped++
+		}
+	})
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	finished := time.Now()
+	j.Status, j.Finished, j.Run = JobFinished, &finished, &run
+	if run.Stopped {
+		j.Status = JobStopped
+	}
+}
+
+// handleJobs lists the jobs, the newest first
+func (a *apiServer) handleJobs(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	jobs := make([]jobJSON, 0, len(a.jobs))
+	for _, j := range slices.Backward(a.jobs) {
+		jobs = append(jobs, j.jobJSON)
+	}
+	a.mu.Unlock()
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+func (a *apiServer) handleJob(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	j := a.job(r.PathValue("id"))
+	var state jobJSON
+	if j != nil {
+		state = j.jobJSON
+	}
+	a.mu.Unlock()
+	if j == nil {
+		writeError(w, http.StatusNotFound, "unknown job")
+		return
+	}
+	writeJSON(w, http.StatusOK, state)
+}
+
+// handleJobErrors lists the files of the job that failed to download
+func (a *apiServer) handleJobErrors(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	j := a.job(r.PathValue("id"))
+	var errs []download.Event
+	if j != nil {
+		errs = slices.Clone(j.errors)
+	}
+	a.mu.Unlock()
+	if j == nil {
+		writeError(w, http.StatusNotFound, "unknown job")
+		return
+	}
+	writeJSON(w, http.StatusOK, errs)
+}
+
+// job returns the job with the ID, or nil if it is unknown or was removed. It must be called with the lock held.
+func (a *apiServer) job(id string) *job {
+	for _, j := range a.jobs {
+		if j.ID == id {
+			return j
+		}
+	}
+	return nil
+}
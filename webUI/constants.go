@@ -295,6 +295,7 @@ const (
 	<button type="button" id="select-all" class="submit-button">Select All</button>
     
     <form action="/submit" method="post">
+        <input type="hidden" name="csrf_token" value="{{.CSRFToken}}">
         <div class="course-container">`
 
 	courseSelectorHTMLEnd = `</div>
@@ -329,5 +330,338 @@ const (
         });
     </script>
 </body>
+</html>`
+
+	dashboardHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>AGDownloader</title>
+    <meta name="csrf-token" content="{{.CSRFToken}}">
+    <style>
+        * {
+            box-sizing: border-box;
+            font-family: -apple-system, BlinkMacSystemFont, 'Segoe UI', Roboto, Oxygen, Ubuntu, Cantarell, 'Open Sans', 'Helvetica Neue', sans-serif;
+        }
+
+        body {
+            max-width: 1200px;
+            margin: 0 auto;
+            padding: 20px;
+            background-color: #f5f5f5;
+            color: #333;
+        }
+
+        h1 {
+            margin-bottom: 20px;
+        }
+
+        h2 {
+            font-size: 18px;
+            margin-top: 0;
+        }
+
+        .layout {
+            display: grid;
+            grid-template-columns: 1fr 1fr;
+            gap: 20px;
+        }
+
+        .card {
+            background-color: white;
+            border-radius: 8px;
+            box-shadow: 0 2px 4px rgba(0,0,0,0.05);
+            padding: 20px;
+            margin-bottom: 20px;
+        }
+
+        input[type=search] {
+            width: 100%;
+            padding: 10px;
+            border: 2px solid #e0e0e0;
+            border-radius: 6px;
+            font-size: 15px;
+            margin-bottom: 10px;
+        }
+
+        .course {
+            display: flex;
+            align-items: center;
+            gap: 10px;
+            padding: 8px;
+            border-radius: 6px;
+        }
+
+        .course:hover, .course.active {
+            background-color: #eff6ff;
+        }
+
+        .course .name {
+            flex: 1;
+            cursor: pointer;
+        }
+
+        .meta, .details {
+            color: #888;
+            font-size: 13px;
+        }
+
+        .downloaded {
+            color: #16a34a;
+            font-size: 13px;
+        }
+
+        details {
+            margin-left: 10px;
+        }
+
+        summary {
+            cursor: pointer;
+            padding: 4px 0;
+        }
+
+        .file {
+            margin-left: 30px;
+            padding: 2px 0;
+        }
+
+        button {
+            padding: 12px 24px;
+            background-color: #2563eb;
+            color: white;
+            border: none;
+            border-radius: 6px;
+            font-size: 16px;
+            font-weight: 600;
+            cursor: pointer;
+        }
+
+        button:disabled {
+            background-color: #93c5fd;
+            cursor: default;
+        }
+
+        progress {
+            width: 100%;
+            height: 16px;
+            margin: 10px 0;
+        }
+
+        .error {
+            color: #dc2626;
+            font-size: 13px;
+            margin: 4px 0;
+        }
+
+        table {
+            width: 100%;
+            border-collapse: collapse;
+            font-size: 14px;
+        }
+
+        th, td {
+            text-align: left;
+            padding: 6px;
+            border-bottom: 1px solid #e0e0e0;
+        }
+    </style>
+</head>
+<body>
+    <h1>AGDownloader</h1>
+    <div class="layout">
+        <div>
+            <div class="card">
+                <h2>Courses</h2>
+                <input type="search" id="search" placeholder="Search by name, short name or ID">
+                <div id="courses"></div>
+            </div>
+        </div>
+        <div>
+            <div class="card">
+                <h2>Sync</h2>
+                <button id="sync" disabled>Sync now</button>
+                <p id="status" class="meta">Select the courses to sync.</p>
+                <progress id="progress" value="0" max="1" hidden></progress>
+                <div id="errors"></div>
+            </div>
+            <div class="card">
+                <h2 id="files-title">Files</h2>
+                <div id="files" class="meta">Click on a course to see its files.</div>
+            </div>
+        </div>
+    </div>
+    <div class="card">
+        <h2>History</h2>
+        <table>
+            <thead><tr><th>Started</th><th>Courses</th><th>Downloaded</th><th>Failed</th><th>Skipped</th></tr></thead>
+            <tbody id="history"></tbody>
+        </table>
+    </div>
+
+    <script>
+        // The names come from AulaGlobal, so they are always inserted as text, never as HTML
+        function element(tag, className, text) {
+            const el = document.createElement(tag);
+            if (className) el.className = className;
+            if (text !== undefined) el.textContent = text;
+            return el;
+        }
+
+        function formatBytes(size) {
+            const units = ['B', 'KiB', 'MiB', 'GiB', 'TiB'];
+            let i = 0;
+            while (size >= 1024 && i < units.length - 1) {
+                size /= 1024;
+                i++;
+            }
+            return (i === 0 ? size : size.toFixed(1)) + ' ' + units[i];
+        }
+
+        function fold(text) {
+            return text.normalize('NFD').replace(/[\u0300-\u036f]/g, '').toLowerCase();
+        }
+
+        const selected = new Set();
+        let courses = [];
+        let running = false;
+
+        function renderCourses() {
+            const query = fold(document.getElementById('search').value);
+            const list = document.getElementById('courses');
+            list.replaceChildren();
+            for (const course of courses) {
+                if (query && !fold(course.name + ' ' + course.short_name + ' ' + course.id).includes(query)) continue;
+                const row = element('div', 'course');
+                const checkbox = element('input');
+                checkbox.type = 'checkbox';
+                checkbox.checked = selected.has(course.id);
+                checkbox.addEventListener('change', () => {
+                    checkbox.checked ? selected.add(course.id) : selected.delete(course.id);
+                    updateSyncButton();
+                });
+                const name = element('span', 'name', (course.favourite ? '★ ' : '') + course.name);
+                name.addEventListener('click', () => {
+                    document.querySelectorAll('.course.active').forEach(el => el.classList.remove('active'));
+                    row.classList.add('active');
+                    loadFiles(course);
+                });
+                const meta = [course.id, course.year, course.semester ? 'S' + course.semester : ''].filter(Boolean).join(' · ');
+                row.append(checkbox, name, element('span', 'meta', meta));
+                list.append(row);
+            }
+        }
+
+        async function loadFiles(course) {
+            document.getElementById('files-title').textContent = 'Files of ' + course.name;
+            const container = document.getElementById('files');
+            container.replaceChildren(element('span', 'meta', 'Loading...'));
+            const response = await fetch('/api/courses/' + encodeURIComponent(course.id) + '/files');
+            const body = await response.json();
+            container.replaceChildren();
+            if (!response.ok) {
+                container.append(element('div', 'error', body.error));
+                return;
+            }
+            if (body.length === 0) {
+                container.append(element('span', 'meta', 'The course has no files.'));
+            }
+            for (const section of body) {
+                const sectionEl = element('details');
+                sectionEl.append(element('summary', '', section.name));
+                for (const module of section.modules) {
+                    const moduleEl = element('details');
+                    moduleEl.append(element('summary', '', module.name || '(no module)'));
+                    for (const file of module.files) {
+                        const fileEl = element('div', 'file', file.name + ' ');
+                        const date = file.modified ? ' · ' + new Date(file.modified * 1000).toLocaleDateString() : '';
+                        fileEl.append(element('span', 'details', formatBytes(file.size) + date));
+                        if (file.downloaded) fileEl.append(element('span', 'downloaded', ' ✓ downloaded'));
+                        moduleEl.append(fileEl);
+                    }
+                    sectionEl.append(moduleEl);
+                }
+                container.append(sectionEl);
+            }
+        }
+
+        function updateSyncButton() {
+            document.getElementById('sync').disabled = running || selected.size === 0;
+        }
+
+        function renderState(state) {
+            running = state.running;
+            updateSyncButton();
+            const status = document.getElementById('status');
+            const progress = document.getElementById('progress');
+            const done = state.downloaded + state.failed + state.skipped;
+            if (state.running) {
+                status.textContent = 'Syncing ' + state.courses.join(', ') + ': ' + done + ' of ' + state.queued + ' files';
+                progress.hidden = false;
+                progress.max = Math.max(state.queued, 1);
+                progress.value = done;
+            } else if (state.last) {
+                status.textContent = 'Last sync: ' + state.downloaded + ' files downloaded, ' + state.failed + ' failed' +
+                    (state.last.stopped ? ', stopped before finishing' : '');
+                progress.hidden = true;
+            }
+            const errors = document.getElementById('errors');
+            errors.replaceChildren();
+            for (const error of state.errors || []) {
+                errors.append(element('div', 'error', error.file + ': ' + error.error));
+            }
+        }
+
+        async function loadHistory() {
+            const response = await fetch('/api/history');
+            const runs = await response.json();
+            const table = document.getElementById('history');
+            table.replaceChildren();
+            for (const run of runs) {
+                const row = element('tr');
+                row.append(
+                    element('td', '', new Date(run.start).toLocaleString()),
+                    element('td', '', (run.courses || []).join(', ')),
+                    element('td', '', run.completed),
+                    element('td', '', run.failed),
+                    element('td', '', run.skipped + (run.stopped ? ' (stopped)' : '')),
+                );
+                table.append(row);
+            }
+        }
+
+        document.getElementById('search').addEventListener('input', renderCourses);
+
+        document.getElementById('sync').addEventListener('click', async () => {
+            const response = await fetch('/api/sync', {
+                method: 'POST',
+                headers: {
+                    'Content-Type': 'application/json',
+                    'X-CSRF-Token': document.querySelector('meta[name=csrf-token]').content,
+                },
+                body: JSON.stringify({courses: [...selected]}),
+            });
+            const body = await response.json();
+            if (!response.ok) {
+                document.getElementById('status').textContent = body.error;
+                return;
+            }
+            renderState(body);
+        });
+
+        const events = new EventSource('/api/events');
+        events.onmessage = (message) => {
+            const event = JSON.parse(message.data);
+            renderState(event.state);
+            if (event.type === 'finished') loadHistory();
+        };
+
+        fetch('/api/courses').then(response => response.json()).then(body => {
+            courses = body;
+            renderCourses();
+        });
+        loadHistory();
+    </script>
+</body>
 </html>`
 )
@@ -3,11 +3,13 @@ package webui
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"os/exec"
 	"runtime"
 	"strings"
 	"time"
 
+	logging "github.com/Astrak00/AGDownloader/logging"
 	"github.com/chromedp/cdproto/network"
 	"github.com/chromedp/chromedp"
 )
@@ -23,9 +25,9 @@ func AskForCookieWeb() string {
 
 	// Log the error and fall back to manual method
 	if err != nil {
-		fmt.Printf("Chrome automation not available: %v\n", err)
+		slog.Warn("Chrome automation not available", logging.KeyError, err)
 	}
-	fmt.Println("Falling back to manual cookie extraction...")
+	slog.Info("Falling back to manual cookie extraction")
 	openBrowser("https://aulaglobal.uc3m.es")
 
 	return ""
@@ -38,7 +40,7 @@ func getCookieWithChrome() (string, error) {
 		return "", fmt.Errorf("Chrome or Chromium not found")
 	}
 
-	fmt.Println("Please log in with your UC3M credentials. The cookie will be captured automatically.")
+	slog.Info("Please log in with your UC3M credentials. The cookie will be captured automatically")
 
 	// Create a new Chrome context with visible browser
 	opts := append(chromedp.DefaultExecAllocatorOptions[:],
@@ -122,7 +124,7 @@ func getCookieWithChrome() (string, error) {
 					!strings.Contains(currentURL, "/login/") &&
 					!strings.Contains(currentURL, "sso.uc3m.es") && cookie != "" {
 					moodleCookie = cookie
-					fmt.Println("Cookie captured successfully!")
+					slog.Info("Cookie captured successfully")
 					return moodleCookie, nil
 				}
 			}
@@ -141,7 +143,7 @@ func getCookieWithChrome() (string, error) {
 
 			var currentURL string
 			if err := chromedp.Run(ctx, chromedp.Location(&currentURL)); err != nil {
-				fmt.Printf("Error retrieving current URL: %v\n", err)
+				slog.Debug("Error retrieving current URL", logging.KeyError, err)
 				continue
 			}
 
@@ -151,7 +153,7 @@ func getCookieWithChrome() (string, error) {
 				!strings.Contains(currentURL, "sso.uc3m.es") {
 				for _, cookie := range cookies {
 					if cookie.Name == "MoodleSessionag" && cookie.Value != "" {
-						fmt.Println("Cookie captured successfully!")
+						slog.Info("Cookie captured successfully")
 						return cookie.Value, nil
 					}
 				}
@@ -210,7 +212,6 @@ func openBrowser(url string) {
 	}
 
 	if err != nil {
-		fmt.Println("Error opening browser:", err)
-		fmt.Println("Please open the following URL manually:", url)
+		slog.Warn("Error opening browser, please open the URL manually", "url", url, logging.KeyError, err)
 	}
 }
@@ -1,85 +1,103 @@
 package webui
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"html/template"
+	"log/slog"
 	"net/http"
-	"os/exec"
+	"time"
 
+	logging "github.com/Astrak00/AGDownloader/logging"
+	redact "github.com/Astrak00/AGDownloader/redact"
 	"github.com/Astrak00/AGDownloader/types"
 )
 
-var courseList []types.Course
-
-func ShowCourseWeb(courses []types.Course) []types.Course {
-	courseList = courses
+// courseSelectorTemplate escapes the names of the courses, that come from AulaGlobal
+var courseSelectorTemplate = template.Must(template.New("courses").Parse(courseSelectorHTMLStart + `{{range .Courses}} <label class="course-option" for="course{{.ID}}">
+                <input type="checkbox" id="course{{.ID}}" name="courses" value="{{.ID}}" class="hidden-checkbox">
+                <div class="checkmark">✓</div>
+                <div class="course-title">{{.Name}}</div>
+            </label>{{end}}` + courseSelectorHTMLEnd))
 
-	// Handle the main page (the form) and the submission endpoint.
-	http.HandleFunc("/", formHandler)
-	// http.HandleFunc("/submit", submitHandler)
+// shutdownTimeout is how long the requests in progress are waited for when the server stops
+const shutdownTimeout = 5 * time.Second
 
-	// fmt.Println("Server running on http://localhost:8888")
-	// Open the default browser with the URL.
-	err := exec.Command("open", "http://localhost:8888").Start()
+// ShowCourseWeb opens a page in the browser to select the courses and returns the selected ones once the
+// form is submitted. The server listens on the port, or on a free one if it is 0, and is stopped once the
+// courses are selected or the context is cancelled.
+func ShowCourseWeb(ctx context.Context, courses []types.Course, port int) ([]types.Course, error) {
+	s, err := newSession(port)
 	if err != nil {
-		fmt.Println("Error:", err)
+		return nil, err
 	}
 
-	// Start the server and wait for the form submission.
-	selectedCourses := make(chan []string)
-	http.HandleFunc("/submit", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Redirect(w, r, "/", http.StatusSeeOther)
-			return
-		}
+	selectedCourses := make(chan []string, 1)
+	mux := http.NewServeMux()
 
+	// Handle the main page (the form) and the submission endpoint.
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		data := struct {
+			Courses   []types.Course
+			CSRFToken string
+		}{courses, s.csrfToken}
+		if err := courseSelectorTemplate.Execute(w, data); err != nil {
+			slog.Warn("Error rendering the course selector", logging.KeyError, err)
+		}
+	})
+	mux.HandleFunc("POST /submit", func(w http.ResponseWriter, r *http.Request) {
 		// Parse the form values.
 		if err := r.ParseForm(); err != nil {
 			http.Error(w, "Error parsing form", http.StatusBadRequest)
 			return
 		}
 
-		// Get the list of selected courses.
-		selected := r.Form["courses"]
-		selectedCourses <- selected
-
-		w.Header().Set("Content-Type", "text/html")
-
-		correctResponseByte := []byte(correctResponseHTML)
-		w.Write(correctResponseByte)
+		// Get the list of selected courses, only the first submission is used
+		select {
+		case selectedCourses <- r.PostForm["courses"]:
+		default:
+		}
 
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(correctResponseHTML))
 	})
 
-	go http.ListenAndServe(":8888", nil)
+	server := &http.Server{Handler: s.protect(mux)}
+	go func() {
+		defer redact.Recover()
+		if err := server.Serve(s.listener); !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("Error running the web server", logging.KeyError, err)
+		}
+	}()
+	slog.Info("Select the courses in the browser", "url", s.URL())
+	openBrowser(s.URL())
 
 	// Wait for the selected courses.
-	selected := <-selectedCourses
+	var selected []string
+	select {
+	case selected = <-selectedCourses:
+	case <-ctx.Done():
+	}
+
+	// The response to the submission is sent before the server stops
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("Error stopping the web server", logging.KeyError, err)
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
 	var selectedCourseList []types.Course
-	for _, courseName := range selected {
-		for _, course := range courseList {
-			if course.Name == courseName {
+	for _, id := range selected {
+		for _, course := range courses {
+			if course.ID == id {
 				selectedCourseList = append(selectedCourseList, course)
 				break
 			}
 		}
 	}
-	return selectedCourseList
-}
-
-// formHandler serves the HTML form with checkboxes for each letter.
-func formHandler(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/html")
-	courseSelectorHTMLByte := []byte(courseSelectorHTMLStart)
-	w.Write(courseSelectorHTMLByte)
-
-	// Loop through the letters A-Z to create a checkbox for each.
-	for _, course := range courseList {
-		fmt.Fprintf(w, ` <label class="course-option" for="course%s">
-                <input type="checkbox" id="course%s" name="courses" value="%s" class="hidden-checkbox">
-                <div class="checkmark">✓</div>
-                <div class="course-title">%s</div>
-            </label>`, course.Name, course.ID, course.Name, course.Name)
-	}
-
-	courseSelectorHTMLByte = []byte(courseSelectorHTMLEnd)
-	w.Write(courseSelectorHTMLByte)
+	return selectedCourseList, nil
 }
@@ -0,0 +1,402 @@
+package webui
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	download "github.com/Astrak00/AGDownloader/download"
+	files "github.com/Astrak00/AGDownloader/files"
+	history "github.com/Astrak00/AGDownloader/history"
+	logging "github.com/Astrak00/AGDownloader/logging"
+	redact "github.com/Astrak00/AGDownloader/redact"
+	"github.com/Astrak00/AGDownloader/types"
+)
+
+// dashboardTemplate adds the CSRF token to the dashboard
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(dashboardHTML))
+
+// DashboardOptions connects the dashboard to the listing and the downloads
+type DashboardOptions struct {
+	Port      int // Port of the server, 0 picks a free one
+	Courses   []types.Course
+	ListFiles func(ctx context.Context, course types.Course) ([]types.FileStore, error)
+	// Sync downloads the files of the courses, reporting every file to events, and returns the summary of the run
+	Sync    func(ctx context.Context, courses []types.Course, events func(download.Event)) history.Run
+	History func() ([]history.Run, error)
+}
+
+// dashboardState is the progress of the current or last run, sent to the browsers when they connect
+type dashboardState struct {
+	Running    bool             `json:"running"`
+	Courses    []string         `json:"courses"`
+	Queued     int              `json:"queued"`
+	Downloaded int              `json:"downloaded"`
+	Failed     int              `json:"failed"`
+	Skipped    int              `json:"skipped"`
+	Errors     []download.Event `json:"errors"`
+	Last       *history.Run     `json:"last,omitempty"` // Summary of the last run, once it finishes
+}
+
+// dashboardEvent is sent to the browsers through Server-Sent Events
+type dashboardEvent struct {
+	Type  string          `json:"type"` // "started", "finished" or the type of a download.Event
+	File  *download.Event `json:"file,omitempty"`
+	State dashboardState  `json:"state"`
+}
+
+type dashboard struct {
+	opts    DashboardOptions
+	ctx     context.Context
+	session *session
+	runs    sync.WaitGroup
+
+	mu          sync.Mutex
+	state       dashboardState
+	subscribers map[chan dashboardEvent]struct{}
+}
+
+// RunDashboard serves the dashboard until the context is cancelled, and waits for the run in progress to finish.
+// The dashboard lists the courses and their files, and syncs the selected courses showing their progress.
+func RunDashboard(ctx context.Context, opts DashboardOptions) error {
+	s, err := newSession(opts.Port)
+	if err != nil {
+		return err
+	}
+	d := &dashboard{opts: opts, ctx: ctx, session: s, subscribers: make(map[chan dashboardEvent]struct{})}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", d.handleIndex)
+	mux.HandleFunc("GET /api/courses", d.handleCourses)
+	mux.HandleFunc("GET /api/courses/{id}/files", d.handleFiles)
+	mux.HandleFunc("POST /api/sync", d.handleSync)
+	mux.HandleFunc("GET /api/state", d.handleState)
+	mux.HandleFunc("GET /api/events", d.handleEvents)
+	mux.HandleFunc("GET /api/history", d.handleHistory)
+
+	server := &http.Server{Handler: s.protect(mux)}
+	slog.Info("Dashboard running, press Ctrl-C to stop it", "url", s.URL())
+	openBrowser(s.URL())
+
+	// The requests are finished before waiting for the run in progress, so no new run can be started
+	stopped := make(chan struct{})
+	go func() {
+		defer redact.Recover()
+		defer close(stopped)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			slog.Warn("Error stopping the dashboard", logging.KeyError, err)
+		}
+	}()
+
+	if err := server.Serve(s.listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	<-stopped
+	d.runs.Wait()
+	return nil
+}
+
+func (d *dashboard) handleIndex(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	data := struct{ CSRFToken string }{d.session.csrfToken}
+	if err := dashboardTemplate.Execute(w, data); err != nil {
+		slog.Warn("Error rendering the dashboard", logging.KeyError, err)
+	}
+}
+
+// courseJSON is a course as listed by the dashboard and the API
+type courseJSON struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	ShortName string `json:"short_name"`
+	Year      string `json:"year"`
+	Semester  int    `json:"semester"`
+	Favourite bool   `json:"favourite"`
+}
+
+func (d *dashboard) handleCourses(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, coursesJSON(d.opts.Courses))
+}
+
+// coursesJSON converts the courses to the JSON of the dashboard and the API
+func coursesJSON(courses []types.Course) []courseJSON {
+	converted := make([]courseJSON, 0, len(courses))
+	for _, course := range courses {
+		year, semester := course.AcademicYear()
+		formatted := ""
+		if year != 0 {
+			formatted = types.FormatAcademicYear(year, "/")
+		}
+		converted = append(converted, courseJSON{
+			ID:        course.ID,
+			Name:      course.Name,
+			ShortName: course.ShortName,
+			Year:      formatted,
+			Semester:  semester,
+			Favourite: course.Favourite,
+		})
+	}
+	return converted
+}
+
+// sectionJSON, moduleJSON and fileJSON are the tree of files of a course
+type sectionJSON struct {
+	Name    string       `json:"name"`
+	Modules []moduleJSON `json:"modules"`
+}
+
+type moduleJSON struct {
+	Name  string     `json:"name"`
+	Files []fileJSON `json:"files"`
+}
+
+type fileJSON struct {
+	Name       string `json:"name"`
+	Path       string `json:"path"`
+	Size       int64  `json:"size"`
+	Modified   int64  `json:"modified"`
+	Downloaded bool   `json:"downloaded"`
+}
+
+func (d *dashboard) handleFiles(w http.ResponseWriter, r *http.Request) {
+	course, ok := findCourse(d.opts.Courses, r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown course")
+		return
+	}
+	listed, err := d.opts.ListFiles(r.Context(), course)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, redact.Error(err).Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, fileTree(listed))
+}
+
+// fileTree groups the files by section and module, in the order they were listed
+func fileTree(listed []types.FileStore) []sectionJSON {
+	sections := []sectionJSON{}
+	for _, file := range listed {
+		sectionName := file.SectionName
+		if sectionName == "" {
+			sectionName = "General"
+		}
+		i := slices.IndexFunc(sections, func(s sectionJSON) bool { return s.Name == sectionName })
+		if i < 0 {
+			sections = append(sections, sectionJSON{Name: sectionName})
+			i = len(sections) - 1
+		}
+		modules := &sections[i].Modules
+		j := slices.IndexFunc(*modules, func(m moduleJSON) bool { return m.Name == file.ModuleName })
+		if j < 0 {
+			*modules = append(*modules, moduleJSON{Name: file.ModuleName})
+			j = len(*modules) - 1
+		}
+		(*modules)[j].Files = append((*modules)[j].Files, fileJSON{
+			Name:       filepath.Base(file.FileName),
+			Path:       file.FileName,
+			Size:       file.FileSize,
+			Modified:   file.TimeModified,
+			Downloaded: files.IsDownloaded(file),
+		})
+	}
+	return sections
+}
+
+// syncRequest is the body of POST /api/sync
+type syncRequest struct {
+	Courses []string `json:"courses"` // IDs of the courses to sync
+}
+
+func (d *dashboard) handleSync(w http.ResponseWriter, r *http.Request) {
+	var request syncRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request")
+		return
+	}
+	var courses []types.Course
+	for _, id := range request.Courses {
+		course, ok := findCourse(d.opts.Courses, id)
+		if !ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("unknown course %q", id))
+			return
+		}
+		courses = append(courses, course)
+	}
+	if len(courses) == 0 {
+		writeError(w, http.StatusBadRequest, "no course selected")
+		return
+	}
+
+	d.mu.Lock()
+	if d.ctx.Err() != nil {
+		d.mu.Unlock()
+		writeError(w, http.StatusServiceUnavailable, "the dashboard is stopping")
+		return
+	}
+	if d.state.Running {
+		d.mu.Unlock()
+		writeError(w, http.StatusConflict, "a sync is already running")
+		return
+	}
+	d.state = dashboardState{Running: true, Errors: []download.Event{}}
+	for _, course := range courses {
+		d.state.Courses = append(d.state.Courses, course.Name)
+	}
+	d.publish(dashboardEvent{Type: "started"})
+	d.mu.Unlock()
+
+	d.runs.Add(1)
+	go func() {
+		defer redact.Recover()
+		defer d.runs.Done()
+		run := d.opts.Sync(d.ctx, courses, d.record)
+
+		d.mu.Lock()
+		d.state.Running = false
+		d.state.Last = &run
+		d.publish(dashboardEvent{Type: "finished"})
+		d.mu.Unlock()
+	}()
+
+	writeJSON(w, http.StatusAccepted, d.snapshot())
+}
+
+// record updates the progress with the event of a file and sends it to the browsers
+func (d *dashboard) record(event download.Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch event.Type {
+	case download.EventQueued:
+		d.state.Queued++
+	case download.EventDownloaded:
+		d.state.Downloaded++
+	case download.EventFailed:
+		d.state.Failed++
+		d.state.Errors = append(d.state.Errors, event)
+	case download.EventSkipped:
+		d.state.Skipped++
+	}
+	d.publish(dashboardEvent{Type: event.Type, File: &event})
+}
+
+// publish sends the event to every browser, with a copy of the state. It must be called with the lock held.
+// Browsers that are too slow to receive it miss the event, the next one carries the whole state.
+func (d *dashboard) publish(event dashboardEvent) {
+	event.State = d.state
+	event.State.Errors = slices.Clone(d.state.Errors)
+	for subscriber := range d.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+		}
+	}
+}
+
+// snapshot returns a copy of the state
+func (d *dashboard) snapshot() dashboardState {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	state := d.state
+	state.Errors = slices.Clone(d.state.Errors)
+	return state
+}
+
+func (d *dashboard) handleState(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, d.snapshot())
+}
+
+// handleEvents streams the progress of the runs with Server-Sent Events
+func (d *dashboard) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming is not supported")
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	events := make(chan dashboardEvent, 64)
+	d.mu.Lock()
+	d.subscribers[events] = struct{}{}
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		delete(d.subscribers, events)
+		d.mu.Unlock()
+	}()
+
+	send := func(event dashboardEvent) bool {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return false
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+
+	// The browser gets the whole state first, in case it connects while a run is in progress
+	if !send(dashboardEvent{Type: "state", State: d.snapshot()}) {
+		return
+	}
+	for {
+		select {
+		case event := <-events:
+			if !send(event) {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-d.ctx.Done():
+			return
+		}
+	}
+}
+
+func (d *dashboard) handleHistory(w http.ResponseWriter, r *http.Request) {
+	runs, err := d.opts.History()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// The newest runs first
+	slices.Reverse(runs)
+	if runs == nil {
+		runs = []history.Run{}
+	}
+	writeJSON(w, http.StatusOK, runs)
+}
+
+// findCourse returns the course with the ID, if it is one of the courses
+func findCourse(courses []types.Course, id string) (types.Course, bool) {
+	for _, course := range courses {
+		if course.ID == id {
+			return course, true
+		}
+	}
+	return types.Course{}, false
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		slog.Debug("Error writing the response", logging.KeyError, err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,113 @@
+package webui
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+// sessionCookie keeps the secret of the session once the page has been opened with it
+const sessionCookie = "agdownloader_session"
+
+// session protects the local server from the other users and the websites opened in the same computer.
+// The server only listens on the loopback interface, every request must carry the secret of the session,
+// given in the URL opened in the browser, and the forms and API calls that change something must carry
+// the CSRF token embedded in the page.
+type session struct {
+	secret    string
+	csrfToken string
+	listener  net.Listener
+}
+
+// newSession listens on the loopback interface, on the port or on a free one if port is 0
+func newSession(port int) (*session, error) {
+	secret, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	csrfToken, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		return nil, fmt.Errorf("error starting the web server: %v", err)
+	}
+	return &session{secret: secret, csrfToken: csrfToken, listener: listener}, nil
+}
+
+// randomToken returns 32 random bytes encoded in hexadecimal
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating the session secret: %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// URL is the address to open in the browser, including the secret
+func (s *session) URL() string {
+	return fmt.Sprintf("http://%s/?session=%s", s.listener.Addr(), s.secret)
+}
+
+// localHosts returns the hosts a server listening on the loopback address accepts in the requests: the
+// address itself and localhost with the same port. Any other name may come from a DNS rebinding attack.
+func localHosts(addr string) []string {
+	_, port, _ := net.SplitHostPort(addr)
+	return []string{addr, net.JoinHostPort("localhost", port)}
+}
+
+// protect rejects the requests without the secret of the session, in the URL or in the cookie, the
+// requests to another host name, that may come from a DNS rebinding attack, and the POST requests
+// without the CSRF token, in the csrf_token field of the form or in the X-CSRF-Token header.
+func (s *session) protect(next http.Handler) http.Handler {
+	hosts := localHosts(s.listener.Addr().String())
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !slices.Contains(hosts, r.Host) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		secret := r.URL.Query().Get("session")
+		if secret == "" {
+			if cookie, err := r.Cookie(sessionCookie); err == nil {
+				secret = cookie.Value
+			}
+		}
+		if !equalTokens(secret, s.secret) {
+			http.Error(w, "Forbidden: open the URL shown in the terminal", http.StatusForbidden)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			token := r.Header.Get("X-CSRF-Token")
+			if token == "" {
+				token = r.PostFormValue("csrf_token")
+			}
+			if !equalTokens(token, s.csrfToken) {
+				http.Error(w, "Forbidden: invalid CSRF token", http.StatusForbidden)
+				return
+			}
+		}
+
+		// The later requests of the page, such as the API calls, send the secret in the cookie
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Value:    s.secret,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteStrictMode,
+		})
+		next.ServeHTTP(w, r)
+	})
+}
+
+// equalTokens compares the tokens in constant time
+func equalTokens(a, b string) bool {
+	return a != "" && subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}